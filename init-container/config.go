@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var importPathPattern = regexp.MustCompile(`^(import\.)?paths\s*=\s*(schedule|osm)\b`)
+var invalidNameCharacters = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// feedNames derives a directory name for every schedule from the file name of its URL.
+// Names are unique and only depend on the order of the schedules in the config.
+func feedNames(schedules []source) []string {
+	names := make([]string, len(schedules))
+	used := make(map[string]bool)
+
+	for i, schedule := range schedules {
+		name := "schedule"
+		if fileName, err := fileNameForUrl(schedule.url); err == nil {
+			if dot := strings.Index(fileName, "."); dot > 0 {
+				fileName = fileName[:dot]
+			}
+			if sanitized := strings.Trim(invalidNameCharacters.ReplaceAllString(fileName, "_"), "_"); sanitized != "" {
+				name = sanitized
+			}
+		}
+
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%v-%d", name, n)
+		}
+		used[unique] = true
+		names[i] = unique
+	}
+
+	return names
+}
+
+// osmFileNames returns a unique file name for every OpenStreetMap source, so all of
+// them can be downloaded into the same directory. A file is named after the last path
+// segment of its URL, like wget does. Later files with the same name get a number
+// appended to their name, e.g. germany-latest-2.osm.pbf.
+func osmFileNames(maps []source) ([]string, error) {
+	names := make([]string, len(maps))
+	used := make(map[string]bool)
+
+	for i, osm := range maps {
+		fileName, err := fileNameForUrl(osm.url)
+		if err != nil {
+			return nil, err
+		}
+
+		base, extension := fileName, ""
+		if dot := strings.Index(fileName, "."); dot > 0 {
+			base, extension = fileName[:dot], fileName[dot:]
+		}
+
+		unique := fileName
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%v-%d%v", base, n, extension)
+		}
+		used[unique] = true
+		names[i] = unique
+	}
+
+	return names, nil
+}
+
+// writeImportConfig copies the MOTIS config from source to destination and
+// replaces its schedule and osm import paths with importPaths.
+func writeImportConfig(source string, destination string, importPaths []string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	var lines []string
+	section := ""
+	hasImportSection := false
+
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			lines = append(lines, line)
+			if section == "import" && !hasImportSection {
+				hasImportSection = true
+				lines = append(lines, importPaths...)
+			}
+			continue
+		}
+
+		isImportPath := importPathPattern.FindStringSubmatch(trimmed)
+		if isImportPath != nil && (section == "import" || (section == "" && isImportPath[1] != "")) {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if !hasImportSection {
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		lines = append(lines, "", "[import]")
+		lines = append(lines, importPaths...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	output := strings.Join(lines, "\n")
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+
+	return os.WriteFile(destination, []byte(output), 0644)
+}
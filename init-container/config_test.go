@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFeedNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedules []string
+		want      []string
+	}{
+		{"file names without extension", []string{"https://example.com/avv.zip", "https://example.com/feeds/vrs.gtfs.zip"}, []string{"avv", "vrs"}},
+		{"collisions", []string{"https://example.com/gtfs.zip", "https://mirror.example.com/gtfs.zip", "https://example.com/gtfs-2.zip", "https://example.com/gtfs.zip?day=2"}, []string{"gtfs", "gtfs-2", "gtfs-2-2", "gtfs-3"}},
+		{"invalid characters", []string{"https://example.com/AVV%20GTFS+SPNV.zip"}, []string{"AVV_GTFS_SPNV"}},
+		{"no usable file name", []string{"https://example.com/%zz", "https://example.com/%2B%2B.zip", "https://example.com/"}, []string{"schedule", "schedule-2", "index"}},
+	}
+
+	for _, test := range tests {
+		var schedules []source
+		for _, url := range test.schedules {
+			schedules = append(schedules, source{url: url})
+		}
+
+		if got := feedNames(schedules); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: feedNames() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWriteImportConfig(t *testing.T) {
+	importPaths := []string{"paths=schedule-avv:/input/schedule/avv", "paths=osm:/input/osm/germany.osm.pbf"}
+
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			"existing import section",
+			"modules=routing\n\n[import]\ndata_dir=/data\n\n[ppr]\nprofile=default.json\n",
+			"modules=routing\n\n[import]\npaths=schedule-avv:/input/schedule/avv\npaths=osm:/input/osm/germany.osm.pbf\ndata_dir=/data\n\n[ppr]\nprofile=default.json\n",
+		},
+		{
+			"no import section",
+			"modules=routing\ndataset.cache_graph=true",
+			"modules=routing\ndataset.cache_graph=true\n\n[import]\npaths=schedule-avv:/input/schedule/avv\npaths=osm:/input/osm/germany.osm.pbf\n",
+		},
+		{
+			"replaced import paths",
+			"import.paths=schedule:/old\nmodules=routing\n\n[import]\npaths=schedule:/old\npaths = osm:/old.osm.pbf\npaths=other:/kept\n",
+			"modules=routing\n\n[import]\npaths=schedule-avv:/input/schedule/avv\npaths=osm:/input/osm/germany.osm.pbf\npaths=other:/kept\n",
+		},
+		{
+			"paths of other sections",
+			"[osrm]\npaths=osm:/kept\n",
+			"[osrm]\npaths=osm:/kept\n\n[import]\npaths=schedule-avv:/input/schedule/avv\npaths=osm:/input/osm/germany.osm.pbf\n",
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "config", "config.ini")
+		destination := filepath.Join(dir, "input", "config.ini")
+		if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(source, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeImportConfig(source, destination, importPaths); err != nil {
+			t.Errorf("%v: writeImportConfig() error = %v", test.name, err)
+			continue
+		}
+
+		got, err := os.ReadFile(destination)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%v: writeImportConfig() wrote\n%v\nwant\n%v", test.name, string(got), test.want)
+		}
+	}
+}
+
+func TestOsmFileNames(t *testing.T) {
+	maps := []source{
+		{url: "https://download.geofabrik.de/europe/germany-latest.osm.pbf"},
+		{url: "https://mirror.example.com/germany-latest.osm.pbf"},
+		{url: "https://example.com/germany-latest-2.osm.pbf"},
+		{url: "https://example.com/"},
+	}
+	want := []string{"germany-latest.osm.pbf", "germany-latest-2.osm.pbf", "germany-latest-2-2.osm.pbf", "index.html"}
+
+	got, err := osmFileNames(maps)
+	if err != nil {
+		t.Fatalf("osmFileNames() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("osmFileNames() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// credentials are added to every request to a host. They are read from a file
+// named after the host. The operator parses the same format when it checks the
+// sources for updates, and rejects malformed lines in the same way. A file may
+// contain the following lines:
+//
+//	bearer=<token>
+//	basic=<username>:<password>
+//	header=<name>: <value>
+type credentials struct {
+	bearer   string
+	username string
+	password string
+	headers  http.Header
+}
+
+// readCredentials reads the credentials of all hosts from dir. A missing
+// directory means that no credentials are configured.
+func readCredentials(dir string) (map[string]credentials, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]credentials{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]credentials)
+	for _, entry := range entries {
+		// Secret volumes contain hidden directories and symlinks used for atomic updates.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := parseCredentials(string(content))
+		if err != nil {
+			// The error must not include the content of the file.
+			return nil, fmt.Errorf("invalid credentials for host %v: %w", entry.Name(), err)
+		}
+		hosts[strings.ToLower(entry.Name())] = c
+	}
+
+	return hosts, nil
+}
+
+func parseCredentials(content string) (credentials, error) {
+	c := credentials{headers: http.Header{}}
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, value, found := strings.Cut(line, "=")
+		if !found {
+			return c, fmt.Errorf("line %d: expected bearer=, basic= or header=", i+1)
+		}
+
+		switch kind {
+		case "bearer":
+			c.bearer = value
+		case "basic":
+			username, password, found := strings.Cut(value, ":")
+			if !found {
+				return c, fmt.Errorf("line %d: expected basic=<username>:<password>", i+1)
+			}
+			c.username, c.password = username, password
+		case "header":
+			name, headerValue, found := strings.Cut(value, ":")
+			if !found {
+				return c, fmt.Errorf("line %d: expected header=<name>: <value>", i+1)
+			}
+			c.headers.Add(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+		default:
+			return c, fmt.Errorf("line %d: unknown credential type %q", i+1, kind)
+		}
+	}
+
+	return c, nil
+}
+
+func (c credentials) apply(req *http.Request) {
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for name, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
+
+// credentialsTransport adds the credentials of the requested host to every
+// request. As it is applied to every single request, redirects to other hosts
+// never receive credentials which were meant for the original host.
+type credentialsTransport struct {
+	base  http.RoundTripper
+	hosts map[string]credentials
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, ok := t.hosts[strings.ToLower(req.URL.Hostname())]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	c.apply(req)
+	return t.base.RoundTrip(req)
+}
+
+// redactUrl removes the user info and the query, which may hold credentials or a
+// token, from rawUrl, so it can be logged or reported. The operator redacts the
+// URLs it logs and stores in the same way.
+func redactUrl(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return redactParsedUrl(parsedUrl)
+}
+
+func redactParsedUrl(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	redacted.Fragment = ""
+	redacted.RawFragment = ""
+	return redacted.String()
+}
+
+// redactError removes the URL from errors of the HTTP client, as it may contain credentials.
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%v %v: %w", urlErr.Op, redactUrl(urlErr.URL), urlErr.Err)
+	}
+	return err
+}
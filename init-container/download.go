@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const initialBackoff = 2 * time.Second
+const maxBackoff = 2 * time.Minute
+
+// downloader fetches files over HTTP. Failed attempts are retried with an
+// exponential backoff and interrupted transfers are resumed using range requests.
+type downloader struct {
+	client         *http.Client
+	retries        int
+	requestTimeout time.Duration
+	// progress is set while a batch of downloads is running.
+	progress *batchProgress
+}
+
+// statusError is returned if a server answers with an unexpected HTTP status.
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d %v", e.status, http.StatusText(e.status))
+}
+
+// permanentError marks errors which will not go away by retrying the download.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func newDownloader(retries int, requestTimeout time.Duration, hosts map[string]credentials) *downloader {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: 2 * time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &downloader{
+		client:         &http.Client{Transport: &credentialsTransport{base: transport, hosts: hosts}},
+		retries:        retries,
+		requestTimeout: requestTimeout,
+	}
+}
+
+// fetch describes a completed download.
+type fetch struct {
+	// file is the path of the downloaded file.
+	file string
+	// resolvedUrl is the URL the file was finally served from, after following redirects.
+	resolvedUrl string
+	// status is the HTTP status of the last request.
+	status int
+	etag   string
+	size   int64
+	// fetchedAt is the time the download finished.
+	fetchedAt time.Time
+}
+
+// download fetches rawUrl into dir/fileName.
+func (d *downloader) download(ctx context.Context, rawUrl string, dir string, fileName string) (fetch, error) {
+	result := fetch{}
+	destination := filepath.Join(dir, fileName)
+	partial := destination + ".part"
+
+	// validator holds the ETag or Last-Modified value of the response the partial file
+	// was started from, so resumed requests only append to it if the file did not change
+	// remotely. It is stored next to the partial file, which may be left on the input
+	// volume by an earlier pod.
+	validator, err := readValidator(partial)
+	if err != nil {
+		return result, &permanentError{err}
+	}
+	backoff := initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := d.attempt(ctx, rawUrl, partial, &validator, &result)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("download of %v aborted: %w", redactUrl(rawUrl), ctx.Err())
+		}
+		if !isRetryable(err) || attempt > d.retries {
+			return result, fmt.Errorf("download of %v failed after %d attempt(s): %w", redactUrl(rawUrl), attempt, err)
+		}
+
+		fmt.Printf("Download of %v failed (attempt %d of %d): %v. Retrying in %v\n", redactUrl(rawUrl), attempt, d.retries+1, err, backoff)
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("download of %v aborted: %w", redactUrl(rawUrl), ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	if err := os.Rename(partial, destination); err != nil {
+		return result, fmt.Errorf("error moving %v to %v: %w", partial, destination, err)
+	}
+	if err := os.Remove(partial + validatorSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return result, err
+	}
+
+	info, err := os.Stat(destination)
+	if err != nil {
+		return result, err
+	}
+
+	result.file = destination
+	result.size = info.Size()
+	result.fetchedAt = time.Now().UTC().Truncate(time.Second)
+	return result, nil
+}
+
+// attempt performs a single request for rawUrl. If partial already contains
+// data, only the missing bytes are requested and appended. The response is
+// recorded in result.
+func (d *downloader) attempt(ctx context.Context, rawUrl string, partial string, validator *string, result *fetch) error {
+	ctx, cancel := context.WithTimeout(ctx, d.requestTimeout)
+	defer cancel()
+
+	offset := int64(0)
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	if offset > 0 && *validator == "" {
+		// Without a validator, the remaining bytes may belong to another version of the file.
+		if err := os.Remove(partial); err != nil {
+			return &permanentError{err}
+		}
+		offset = 0
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return &permanentError{redactError(err)}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if *validator != "" {
+			req.Header.Set("If-Range", *validator)
+		}
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		d.progress.restart(partial, 0)
+	case http.StatusPartialContent:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			// The server did not continue where we stopped. Start over.
+			if err := os.Remove(partial); err != nil {
+				return &permanentError{err}
+			}
+			return fmt.Errorf("server returned range starting at byte %d instead of %d", start, offset)
+		}
+		flags |= os.O_APPEND
+		d.progress.restart(partial, offset)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file does not match the remote file anymore. Start over.
+		if err := os.Remove(partial); err != nil {
+			return &permanentError{err}
+		}
+		return &statusError{resp.StatusCode}
+	default:
+		return &statusError{resp.StatusCode}
+	}
+
+	result.resolvedUrl = redactParsedUrl(resp.Request.URL)
+	result.status = resp.StatusCode
+	result.etag = resp.Header.Get("ETag")
+
+	if resp.StatusCode == http.StatusOK {
+		if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			*validator = etag
+		} else {
+			*validator = resp.Header.Get("Last-Modified")
+		}
+		if err := writeValidator(partial, *validator); err != nil {
+			return &permanentError{err}
+		}
+	}
+
+	file, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	_, copyErr := io.Copy(file, d.progress.reader(partial, resp.Body))
+	if err := file.Close(); err != nil && copyErr == nil {
+		return &permanentError{err}
+	}
+
+	return copyErr
+}
+
+// The suffix of the file next to a partial download holding its validator.
+const validatorSuffix = ".validator"
+
+// readValidator returns the validator stored for partial. If there is none, a left
+// over partial file cannot be resumed safely and is removed.
+func readValidator(partial string) (string, error) {
+	content, err := os.ReadFile(partial + validatorSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	validator := strings.TrimSpace(string(content))
+	if validator == "" {
+		if err := os.Remove(partial); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return validator, nil
+}
+
+// writeValidator stores validator for partial, or removes the stored one if validator is empty.
+func writeValidator(partial string, validator string) error {
+	if validator == "" {
+		if err := os.Remove(partial + validatorSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(partial+validatorSuffix, []byte(validator+"\n"), 0644)
+}
+
+func isRetryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.status == http.StatusRequestTimeout ||
+			status.status == http.StatusRequestedRangeNotSatisfiable ||
+			status.status == http.StatusTooManyRequests ||
+			status.status >= 500
+	}
+
+	return true
+}
+
+// rangeStart parses the first byte position of a Content-Range header like "bytes 100-199/200".
+func rangeStart(contentRange string) (int64, bool) {
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, false
+	}
+
+	start, err := strconv.ParseInt(spec[:dash], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return start, true
+}
+
+func fileNameForUrl(rawUrl string) (string, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %v: %w", redactUrl(rawUrl), err)
+	}
+
+	fileName := path.Base(parsedUrl.Path)
+	if fileName == "/" || fileName == "." {
+		return "index.html", nil
+	}
+
+	return fileName, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadResumesOnlyWithValidator(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, req, "osm.pbf", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		partial   string
+		validator string
+		wantRange string
+	}{
+		{"no partial file", "", "", ""},
+		{"partial file without validator", "0123456789XXXX", "", ""},
+		{"partial file of another version", "0123456789XXXX", `"v1"`, "bytes=14-"},
+		{"partial file of the same version", "0123456789", `"v2"`, "bytes=10-"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		partial := filepath.Join(dir, "osm.pbf.part")
+		if test.partial != "" {
+			if err := os.WriteFile(partial, []byte(test.partial), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.validator != "" {
+			if err := os.WriteFile(partial+validatorSuffix, []byte(test.validator), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ranges = nil
+		d := newDownloader(0, time.Minute, nil)
+		result, err := d.download(context.Background(), server.URL+"/osm.pbf", dir, "osm.pbf")
+		if err != nil {
+			t.Fatalf("%v: download() error = %v", test.name, err)
+		}
+
+		if got, _ := os.ReadFile(result.file); !bytes.Equal(got, content) {
+			t.Errorf("%v: downloaded %q, want %q", test.name, got, content)
+		}
+		if len(ranges) != 1 || ranges[0] != test.wantRange {
+			t.Errorf("%v: requested ranges %q, want %q", test.name, ranges, test.wantRange)
+		}
+		if _, err := os.Stat(partial + validatorSuffix); !os.IsNotExist(err) {
+			t.Errorf("%v: validator of the partial file was not removed", test.name)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type archiveFormat string
+
+const (
+	formatZip     archiveFormat = "zip"
+	formatTar     archiveFormat = "tar"
+	formatTarGzip archiveFormat = "tar.gz"
+	formatGzip    archiveFormat = "gzip"
+	// formatPlain is any other file, which is copied as it is.
+	formatPlain archiveFormat = "plain"
+	// formatDirectory is a directory, whose files are copied as they are.
+	formatDirectory archiveFormat = "directory"
+)
+
+var errSizeLimitExceeded = errors.New("archive exceeds the maximum extracted size")
+
+// extract unpacks the archive at path into dir. The format is detected from the
+// content of the file. Plain files and directories are copied into dir unchanged.
+// At most limit bytes are extracted, and entries which would be written outside of
+// dir are rejected. If the archive only contains a single directory, its content is
+// moved up into dir.
+func extract(path string, dir string, limit int64) error {
+	format, err := detectFormat(path)
+	if err != nil {
+		return err
+	}
+
+	if format == formatPlain || format == formatDirectory {
+		fmt.Printf("Copying %v to %v\n", path, dir)
+	} else {
+		fmt.Printf("Extracting %v archive %v to %v\n", format, path, dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	budget := &sizeBudget{remaining: limit}
+	switch format {
+	case formatZip:
+		err = extractZip(path, dir, budget)
+	case formatTar:
+		err = withFile(path, func(r io.Reader) error { return extractTar(r, dir, budget) })
+	case formatTarGzip:
+		err = withGzip(path, func(r io.Reader, _ string) error { return extractTar(r, dir, budget) })
+	case formatGzip:
+		err = withGzip(path, func(r io.Reader, name string) error { return writeEntry(dir, name, r, budget) })
+	case formatPlain:
+		err = withFile(path, func(r io.Reader) error { return writeEntry(dir, filepath.Base(path), r, budget) })
+	case formatDirectory:
+		err = copyDirectory(path, dir, budget)
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting %v: %w", path, err)
+	}
+
+	return flattenSingleDirectory(dir)
+}
+
+// detectFormat identifies the archive format of path by its magic bytes. Files
+// which are no archive are plain files.
+func detectFormat(path string) (archiveFormat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return formatDirectory, nil
+	}
+
+	header := make([]byte, 512)
+	n, err := readHeader(path, header)
+	if err != nil {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return formatZip, nil
+	case isTarHeader(header):
+		return formatTar, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		isTar := false
+		err := withGzip(path, func(r io.Reader, _ string) error {
+			decompressed := make([]byte, 512)
+			n, err := io.ReadFull(r, decompressed)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+				return err
+			}
+			isTar = isTarHeader(decompressed[:n])
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if isTar {
+			return formatTarGzip, nil
+		}
+		return formatGzip, nil
+	}
+
+	return formatPlain, nil
+}
+
+func readHeader(path string, header []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := io.ReadFull(f, header)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return n, nil
+	}
+	return n, err
+}
+
+func isTarHeader(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+func withFile(path string, fn func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return fn(bufio.NewReader(f))
+}
+
+// withGzip calls fn with the decompressed content of path and the name of the
+// compressed file, taken from the gzip header or the file name without ".gz".
+func withGzip(path string, fn func(r io.Reader, name string) error) error {
+	return withFile(path, func(r io.Reader) error {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		name := filepath.Base(gz.Name)
+		if gz.Name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), ".gz")
+		}
+		return fn(gz, name)
+	})
+}
+
+func extractZip(path string, dir string, budget *sizeBudget) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			if _, err := safeJoin(dir, file.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			fmt.Printf("Skipping %v: not a regular file\n", file.Name)
+			continue
+		}
+		if file.UncompressedSize64 > uint64(budget.remaining) {
+			return errSizeLimitExceeded
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeEntry(dir, file.Name, content, budget)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractTar(r io.Reader, dir string, budget *sizeBudget) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			target, err := safeJoin(dir, header.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if header.Size > budget.remaining {
+				return errSizeLimitExceeded
+			}
+			if err := writeEntry(dir, header.Name, archive, budget); err != nil {
+				return err
+			}
+		default:
+			fmt.Printf("Skipping %v: not a regular file\n", header.Name)
+		}
+	}
+}
+
+// copyDirectory copies the regular files below source into dir, keeping their relative paths.
+func copyDirectory(source string, dir string, budget *sizeBudget) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == source || entry.IsDir() {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			fmt.Printf("Skipping %v: not a regular file\n", path)
+			return nil
+		}
+
+		name, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		return withFile(path, func(r io.Reader) error { return writeEntry(dir, name, r, budget) })
+	})
+}
+
+// writeEntry writes the content of an archive entry to name within dir.
+func writeEntry(dir string, name string, content io.Reader, budget *sizeBudget) error {
+	target, err := safeJoin(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, copyErr := io.Copy(file, budget.limit(content))
+	if err := file.Close(); err != nil && copyErr == nil {
+		return err
+	}
+	return copyErr
+}
+
+// safeJoin joins dir and the name of an archive entry, rejecting names which
+// would escape dir.
+func safeJoin(dir string, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+
+	target := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q escapes the target directory", name)
+	}
+
+	return target, nil
+}
+
+// flattenSingleDirectory moves the content of dir's only subdirectory into dir.
+// Feeds are often packaged with all their files in a single top level directory.
+func flattenSingleDirectory(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+
+	// Rename the directory first, in case it contains an entry with its own name.
+	nested := filepath.Join(dir, ".flatten-"+entries[0].Name())
+	if err := os.Rename(filepath.Join(dir, entries[0].Name()), nested); err != nil {
+		return err
+	}
+
+	children, err := os.ReadDir(nested)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(nested, child.Name()), filepath.Join(dir, child.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(nested)
+}
+
+// sizeBudget tracks how many bytes may still be extracted.
+type sizeBudget struct {
+	remaining int64
+}
+
+func (b *sizeBudget) limit(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *sizeBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.budget.remaining -= int64(n)
+	if r.budget.remaining < 0 {
+		return n, errSizeLimitExceeded
+	}
+	return n, err
+}
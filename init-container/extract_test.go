@@ -0,0 +1,298 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// entry is a file, directory or symlink of a test archive.
+type entry struct {
+	name    string
+	content string
+	dir     bool
+	link    string
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		switch {
+		case e.dir:
+			header.SetMode(os.ModeDir | 0755)
+		case e.link != "":
+			header.SetMode(os.ModeSymlink | 0777)
+		default:
+			header.SetMode(0644)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := e.content
+		if e.link != "" {
+			content = e.link
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, entries []entry, compress bool) {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	w := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = tar.NewWriter(gz)
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR}
+		switch {
+		case e.dir:
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		case e.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil && header.Typeflag == tar.TypeReg {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listFiles returns the paths of all files and symlinks below dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		entries []entry
+		limit   int64
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "zip",
+			format:  "zip",
+			entries: []entry{{name: "stops.txt", content: "stop_id"}, {name: "sub/", dir: true}, {name: "sub/trips.txt", content: "trip_id"}},
+			want:    []string{"stops.txt", "sub/trips.txt"},
+		},
+		{
+			name:    "single directory is flattened",
+			format:  "tar.gz",
+			entries: []entry{{name: "feed/", dir: true}, {name: "feed/stops.txt", content: "stop_id"}},
+			want:    []string{"stops.txt"},
+		},
+		{
+			name:    "zip slip",
+			format:  "zip",
+			entries: []entry{{name: "../evil.txt", content: "evil"}},
+			wantErr: "escapes the target directory",
+		},
+		{
+			name:    "nested zip slip",
+			format:  "tar",
+			entries: []entry{{name: "feed/../../evil.txt", content: "evil"}},
+			wantErr: "escapes the target directory",
+		},
+		{
+			name:    "zip slip in a directory entry",
+			format:  "tar",
+			entries: []entry{{name: "../evil/", dir: true}},
+			wantErr: "escapes the target directory",
+		},
+		{
+			name:    "absolute path in zip",
+			format:  "zip",
+			entries: []entry{{name: "/etc/evil.txt", content: "evil"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "absolute path in tar",
+			format:  "tar",
+			entries: []entry{{name: "/etc/evil.txt", content: "evil"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "symlink in zip is skipped",
+			format:  "zip",
+			entries: []entry{{name: "stops.txt", content: "stop_id"}, {name: "passwd", link: "/etc/passwd"}},
+			want:    []string{"stops.txt"},
+		},
+		{
+			name:    "symlink in tar is skipped",
+			format:  "tar",
+			entries: []entry{{name: "passwd", link: "/etc/passwd"}, {name: "stops.txt", content: "stop_id"}},
+			want:    []string{"stops.txt"},
+		},
+		{
+			name:    "within the size limit",
+			format:  "zip",
+			entries: []entry{{name: "a.txt", content: "12345"}, {name: "b.txt", content: "12345"}},
+			limit:   10,
+			want:    []string{"a.txt", "b.txt"},
+		},
+		{
+			name:    "zip exceeds the size limit",
+			format:  "zip",
+			entries: []entry{{name: "a.txt", content: "12345"}, {name: "b.txt", content: "123456"}},
+			limit:   10,
+			wantErr: errSizeLimitExceeded.Error(),
+		},
+		{
+			name:    "tar exceeds the size limit",
+			format:  "tar.gz",
+			entries: []entry{{name: "a.txt", content: strings.Repeat("x", 11)}},
+			limit:   10,
+			wantErr: errSizeLimitExceeded.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			archive := filepath.Join(tmp, "feed."+test.format)
+			switch test.format {
+			case "zip":
+				writeZip(t, archive, test.entries)
+			case "tar":
+				writeTar(t, archive, test.entries, false)
+			case "tar.gz":
+				writeTar(t, archive, test.entries, true)
+			}
+
+			limit := test.limit
+			if limit == 0 {
+				limit = 1 << 20
+			}
+			dir := filepath.Join(tmp, "out")
+			err := extract(archive, dir, limit)
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("extract() error = %v, want %q", err, test.wantErr)
+				}
+				if _, err := os.Stat(filepath.Join(tmp, "evil.txt")); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("extract() wrote outside of the target directory")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extract() error = %v", err)
+			}
+			if got := listFiles(t, dir); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("extract() extracted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractPassesThroughPlainFilesAndDirectories(t *testing.T) {
+	tmp := t.TempDir()
+	plain := filepath.Join(tmp, "schedule.txt")
+	if err := os.WriteFile(plain, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmp, "feed")
+	if err := os.MkdirAll(filepath.Join(source, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"stops.txt", "sub/trips.txt"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{plain, []string{"schedule.txt"}},
+		{source, []string{"stops.txt", "sub/trips.txt"}},
+	}
+
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "out")
+		if err := extract(test.path, dir, 1<<20); err != nil {
+			t.Fatalf("extract(%v) error = %v", test.path, err)
+		}
+		if got := listFiles(t, dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("extract(%v) copied %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{"file", "stops.txt", "/out/stops.txt", false},
+		{"nested file", "feed/stops.txt", "/out/feed/stops.txt", false},
+		{"dot segments within dir", "feed/../stops.txt", "/out/stops.txt", false},
+		{"parent", "..", "", true},
+		{"parent file", "../stops.txt", "", true},
+		{"nested parent", "feed/../../stops.txt", "", true},
+		{"absolute", "/stops.txt", "", true},
+		{"name starting with dots", "..stops.txt", "/out/..stops.txt", false},
+	}
+
+	for _, test := range tests {
+		got, err := safeJoin("/out", test.entry)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%v: safeJoin(%q) = %q, %v, want %q, error %v", test.name, test.entry, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The number of issues of each severity listed in the validation report of a feed.
+// Further issues are only counted.
+const maxReportedIssues = 100
+
+// gtfsFile is a file of a GTFS feed together with its required columns.
+type gtfsFile struct {
+	name    string
+	columns []string
+}
+
+// requiredFiles lists the files every GTFS feed has to contain.
+var requiredFiles = []gtfsFile{
+	{"agency.txt", []string{"agency_name", "agency_url", "agency_timezone"}},
+	{"stops.txt", []string{"stop_id"}},
+	{"routes.txt", []string{"route_id", "route_type"}},
+	{"trips.txt", []string{"route_id", "service_id", "trip_id"}},
+	{"stop_times.txt", []string{"trip_id", "stop_id", "stop_sequence"}},
+}
+
+// A feed has to contain at least one of the calendar files.
+var calendarFiles = []gtfsFile{
+	{"calendar.txt", []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}},
+	{"calendar_dates.txt", []string{"service_id", "date", "exception_type"}},
+}
+
+// issue is a single problem found in a feed.
+type issue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// feedValidation is the validation result of a single GTFS feed.
+type feedValidation struct {
+	Name         string  `json:"name"`
+	ErrorCount   int     `json:"errorCount"`
+	WarningCount int     `json:"warningCount"`
+	Errors       []issue `json:"errors"`
+	Warnings     []issue `json:"warnings"`
+}
+
+// validationReport is written as machine-readable report next to the downloaded schedules.
+type validationReport struct {
+	Feeds []feedValidation `json:"feeds"`
+}
+
+// feedSummary is the short form of a feedValidation included in the termination message.
+type feedSummary struct {
+	Name     string `json:"name"`
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+	// FirstError is the first error found in the feed, if any.
+	FirstError string `json:"firstError,omitempty"`
+}
+
+func (v *feedValidation) addError(file string, line int, format string, a ...interface{}) {
+	v.ErrorCount++
+	if len(v.Errors) < maxReportedIssues {
+		v.Errors = append(v.Errors, issue{File: file, Line: line, Message: fmt.Sprintf(format, a...)})
+	}
+}
+
+func (v *feedValidation) addWarning(file string, line int, format string, a ...interface{}) {
+	v.WarningCount++
+	if len(v.Warnings) < maxReportedIssues {
+		v.Warnings = append(v.Warnings, issue{File: file, Line: line, Message: fmt.Sprintf(format, a...)})
+	}
+}
+
+func (v *feedValidation) summary() feedSummary {
+	summary := feedSummary{Name: v.Name, Errors: v.ErrorCount, Warnings: v.WarningCount}
+	if len(v.Errors) > 0 {
+		first := v.Errors[0]
+		summary.FirstError = fmt.Sprintf("%v: %v", first.File, first.Message)
+		if first.Line > 0 {
+			summary.FirstError = fmt.Sprintf("%v:%d: %v", first.File, first.Line, first.Message)
+		}
+	}
+	return summary
+}
+
+func (r *validationReport) failed() bool {
+	for _, feed := range r.Feeds {
+		if feed.ErrorCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *validationReport) summaries() []feedSummary {
+	summaries := make([]feedSummary, len(r.Feeds))
+	for i := range r.Feeds {
+		summaries[i] = r.Feeds[i].summary()
+	}
+	return summaries
+}
+
+func (r *validationReport) write(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// isGtfsFeed reports whether dir looks like a GTFS feed. MOTIS supports other
+// schedule formats as well, which are not validated.
+func isGtfsFeed(dir string) bool {
+	for _, file := range requiredFiles {
+		if _, err := os.Stat(filepath.Join(dir, file.name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFeed checks that the GTFS feed in dir contains all required files and
+// columns, and that trips, routes, stops and services reference each other correctly.
+func validateFeed(name string, dir string) feedValidation {
+	v := feedValidation{Name: name, Errors: []issue{}, Warnings: []issue{}}
+
+	for _, file := range requiredFiles {
+		if _, err := os.Stat(filepath.Join(dir, file.name)); err != nil {
+			v.addError(file.name, 0, "required file is missing")
+			continue
+		}
+		v.checkHeader(dir, file)
+	}
+
+	hasCalendar := false
+	for _, file := range calendarFiles {
+		if _, err := os.Stat(filepath.Join(dir, file.name)); err == nil {
+			hasCalendar = true
+			v.checkHeader(dir, file)
+		}
+	}
+	if !hasCalendar {
+		v.addError("calendar.txt", 0, "feed contains neither calendar.txt nor calendar_dates.txt")
+	}
+
+	if v.ErrorCount > 0 {
+		// Referential integrity can only be checked if all files and columns are present.
+		return v
+	}
+
+	routes := v.collectIds(dir, "routes.txt", "route_id")
+	stops := v.collectIds(dir, "stops.txt", "stop_id")
+	services := v.collectIds(dir, "calendar.txt", "service_id")
+	for service := range v.collectIds(dir, "calendar_dates.txt", "service_id") {
+		services[service] = true
+	}
+
+	trips := make(map[string]bool)
+	v.forEachRow(dir, "trips.txt", func(line int, row map[string]string) {
+		trips[row["trip_id"]] = false
+		if !routes[row["route_id"]] {
+			v.addError("trips.txt", line, "trip %q references unknown route %q", row["trip_id"], row["route_id"])
+		}
+		if !services[row["service_id"]] {
+			v.addError("trips.txt", line, "trip %q references unknown service %q", row["trip_id"], row["service_id"])
+		}
+	})
+
+	v.forEachRow(dir, "stop_times.txt", func(line int, row map[string]string) {
+		if _, known := trips[row["trip_id"]]; !known {
+			v.addError("stop_times.txt", line, "stop time references unknown trip %q", row["trip_id"])
+		} else {
+			trips[row["trip_id"]] = true
+		}
+		if !stops[row["stop_id"]] {
+			v.addError("stop_times.txt", line, "stop time references unknown stop %q", row["stop_id"])
+		}
+	})
+
+	for trip, hasStopTimes := range trips {
+		if !hasStopTimes {
+			v.addWarning("trips.txt", 0, "trip %q has no stop times", trip)
+		}
+	}
+
+	return v
+}
+
+func (v *feedValidation) checkHeader(dir string, file gtfsFile) {
+	f, err := os.Open(filepath.Join(dir, file.name))
+	if err != nil {
+		v.addError(file.name, 0, "error opening file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	header, err := newGtfsReader(f).Read()
+	if err != nil {
+		v.addError(file.name, 1, "error reading header: %v", err)
+		return
+	}
+
+	present := make(map[string]bool)
+	for _, column := range header {
+		present[normalizeColumn(column)] = true
+	}
+	for _, column := range file.columns {
+		if !present[column] {
+			v.addError(file.name, 1, "required column %q is missing", column)
+		}
+	}
+}
+
+// collectIds returns the values of column in file. Duplicate values are reported as errors.
+func (v *feedValidation) collectIds(dir string, file string, column string) map[string]bool {
+	ids := make(map[string]bool)
+	if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+		return ids
+	}
+
+	v.forEachRow(dir, file, func(line int, row map[string]string) {
+		id := row[column]
+		if id == "" {
+			v.addError(file, line, "%v is empty", column)
+			return
+		}
+		if ids[id] && file != "calendar_dates.txt" {
+			v.addError(file, line, "duplicate %v %q", column, id)
+		}
+		ids[id] = true
+	})
+
+	return ids
+}
+
+// forEachRow calls fn for every data row of file with the row's values indexed by column name.
+func (v *feedValidation) forEachRow(dir string, file string, fn func(line int, row map[string]string)) {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		v.addError(file, 0, "error opening file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	reader := newGtfsReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		v.addError(file, 1, "error reading header: %v", err)
+		return
+	}
+	// The reader reuses its record slice, so the header has to be copied.
+	columns := make([]string, len(header))
+	for i := range header {
+		columns[i] = normalizeColumn(header[i])
+	}
+
+	row := make(map[string]string, len(columns))
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			v.addError(file, line, "error reading row: %v", err)
+			return
+		}
+		if len(record) != len(columns) {
+			v.addWarning(file, line, "row has %d fields, header has %d", len(record), len(columns))
+		}
+
+		for i, column := range columns {
+			row[column] = ""
+			if i < len(record) {
+				row[column] = strings.TrimSpace(record[i])
+			}
+		}
+		fn(line, row)
+	}
+}
+
+func newGtfsReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	return reader
+}
+
+// normalizeColumn strips whitespace and a UTF-8 byte order mark from a column name.
+func normalizeColumn(column string) string {
+	return strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// validFeed is a minimal GTFS feed without any issues.
+var validFeed = map[string]string{
+	"agency.txt":     "agency_name,agency_url,agency_timezone\nTest,https://example.com,Europe/Berlin\n",
+	"stops.txt":      "\ufeffstop_id,stop_name\nA,Stop A\nB,Stop B\n",
+	"routes.txt":     "route_id,route_type\nR1,3\n",
+	"trips.txt":      "route_id,service_id,trip_id\nR1,S1,T1\n",
+	"stop_times.txt": "trip_id,stop_id,stop_sequence\nT1,A,1\nT1,B,2\n",
+	"calendar.txt":   "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS1,1,1,1,1,1,0,0,20260101,20261231\n",
+}
+
+func TestValidateFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		// changes replaces files of the valid feed. An empty content removes the file.
+		changes      map[string]string
+		wantErrors   []string
+		wantWarnings []string
+	}{
+		{
+			name: "valid feed",
+		},
+		{
+			name: "calendar dates instead of calendar",
+			changes: map[string]string{
+				"calendar.txt":       "",
+				"calendar_dates.txt": "service_id,date,exception_type\nS1,20260101,1\nS1,20260102,1\n",
+			},
+		},
+		{
+			name:       "missing required file",
+			changes:    map[string]string{"routes.txt": ""},
+			wantErrors: []string{"routes.txt: required file is missing"},
+		},
+		{
+			name:       "missing calendar",
+			changes:    map[string]string{"calendar.txt": ""},
+			wantErrors: []string{"calendar.txt: feed contains neither calendar.txt nor calendar_dates.txt"},
+		},
+		{
+			name:       "missing required column",
+			changes:    map[string]string{"stop_times.txt": "trip_id,stop_id\nT1,A\n"},
+			wantErrors: []string{`stop_times.txt:1: required column "stop_sequence" is missing`},
+		},
+		{
+			name:       "unknown route",
+			changes:    map[string]string{"trips.txt": "route_id,service_id,trip_id\nR2,S1,T1\n"},
+			wantErrors: []string{`trips.txt:2: trip "T1" references unknown route "R2"`},
+		},
+		{
+			name:       "unknown service",
+			changes:    map[string]string{"trips.txt": "route_id,service_id,trip_id\nR1,S2,T1\n"},
+			wantErrors: []string{`trips.txt:2: trip "T1" references unknown service "S2"`},
+		},
+		{
+			name:       "unknown stop and trip",
+			changes:    map[string]string{"stop_times.txt": "trip_id,stop_id,stop_sequence\nT1,A,1\nT2,C,2\n"},
+			wantErrors: []string{`stop_times.txt:3: stop time references unknown trip "T2"`, `stop_times.txt:3: stop time references unknown stop "C"`},
+		},
+		{
+			name:       "duplicate stop",
+			changes:    map[string]string{"stops.txt": "stop_id\nA\nA\nB\n"},
+			wantErrors: []string{`stops.txt:3: duplicate stop_id "A"`},
+		},
+		{
+			name:         "trip without stop times",
+			changes:      map[string]string{"trips.txt": "route_id,service_id,trip_id\nR1,S1,T1\nR1,S1,T2\n"},
+			wantWarnings: []string{`trips.txt: trip "T2" has no stop times`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range validFeed {
+				if change, ok := test.changes[name]; ok {
+					content = change
+				}
+				writeFeedFile(t, dir, name, content)
+			}
+			for name, content := range test.changes {
+				if _, ok := validFeed[name]; !ok {
+					writeFeedFile(t, dir, name, content)
+				}
+			}
+
+			if !isGtfsFeed(dir) {
+				t.Fatalf("isGtfsFeed() = false, want true")
+			}
+			v := validateFeed("feed", dir)
+
+			if got := formatIssues(v.Errors); !equalIssues(got, test.wantErrors) || v.ErrorCount != len(test.wantErrors) {
+				t.Errorf("validateFeed() errors = %d %q, want %q", v.ErrorCount, got, test.wantErrors)
+			}
+			if got := formatIssues(v.Warnings); !equalIssues(got, test.wantWarnings) || v.WarningCount != len(test.wantWarnings) {
+				t.Errorf("validateFeed() warnings = %d %q, want %q", v.WarningCount, got, test.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestIsGtfsFeed(t *testing.T) {
+	dir := t.TempDir()
+	writeFeedFile(t, dir, "schedule.hrd", "not a GTFS feed")
+	if isGtfsFeed(dir) {
+		t.Errorf("isGtfsFeed() = true for a directory without GTFS files")
+	}
+}
+
+func writeFeedFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	if content == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func formatIssues(issues []issue) []string {
+	formatted := make([]string, len(issues))
+	for i := range issues {
+		formatted[i] = (&feedValidation{Errors: issues[i : i+1]}).summary().FirstError
+	}
+	return formatted
+}
+
+// equalIssues compares issues ignoring their order, as trips are checked in map order.
+func equalIssues(got []string, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	got = append([]string{}, got...)
+	want = append([]string{}, want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	return reflect.DeepEqual(got, want)
+}
@@ -1,47 +1,268 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/bitfield/script"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+const credentialsPath = "/credentials"
 const schedulesConfigPath = "/config/schedules"
 const osmConfigPath = "/config/osm"
+const motisConfigPath = "/config/config.ini"
 
-const schedulesDataPath = "/input/schedule"
-const osmDataFolder = "/input"
+// The files written to the input volume, relative to its mount path. The map data is
+// downloaded into the mount path itself.
+const schedulesDataDir = "schedule"
+const importConfigFile = "config.ini"
+const validationReportFile = "validation-report.json"
+const manifestFile = "manifest.json"
+
+// The shared volume the binary installs itself into, so the MOTIS container can run it as wrapper.
+const toolsPath = "/tools"
+
+// options holds the command line flags of the init run.
+type options struct {
+	inputDir         string
+	retries          int
+	requestTimeout   time.Duration
+	timeout          time.Duration
+	skipValidation   bool
+	maxExtractedSize int64
+	concurrency      int
+	perHost          int
+}
+
+// The categories of errors reported in the termination message. They are used
+// as reason of the Dataset conditions by the operator.
+const (
+	categoryConfig       = "InvalidConfig"
+	categoryDownload     = "DownloadFailed"
+	categoryVerification = "VerificationFailed"
+	categoryExtraction   = "ExtractionFailed"
+	categoryValidation   = "ValidationFailed"
+	categoryInternal     = "InternalError"
+)
+
+// runError is an error of the init run together with its category.
+type runError struct {
+	category string
+	err      error
+}
+
+func (e *runError) Error() string {
+	return e.err.Error()
+}
+
+func (e *runError) Unwrap() error {
+	return e.err
+}
+
+func fail(category string, err error) error {
+	return &runError{category: category, err: err}
+}
 
 func main() {
-	scheduleUrls, err := script.File(schedulesConfigPath).Slice()
+	if len(os.Args) > 1 && os.Args[1] == "wrap" {
+		os.Exit(wrap(os.Args[2:]))
+	}
+
+	var opts options
+	flag.StringVar(&opts.inputDir, "input-dir", "/input", "The mount path of the input volume, which the inputs are prepared in.")
+	flag.IntVar(&opts.retries, "retries", 5, "How often a failed download is retried before giving up.")
+	flag.DurationVar(&opts.requestTimeout, "request-timeout", 30*time.Minute, "The maximum duration of a single download attempt.")
+	flag.DurationVar(&opts.timeout, "timeout", 3*time.Hour, "The maximum duration of all downloads combined.")
+	flag.IntVar(&opts.concurrency, "concurrency", 4, "The maximum number of concurrent downloads.")
+	flag.IntVar(&opts.perHost, "per-host", 0, "The maximum number of concurrent downloads from a single host. 0 means no limit.")
+	flag.Int64Var(&opts.maxExtractedSize, "max-extracted-size", 10<<30, "The maximum number of bytes extracted from a single schedule archive.")
+	flag.BoolVar(&opts.skipValidation, "skip-validation", false, "Do not validate GTFS schedules before the import.")
+	flag.Parse()
+
+	summary := &report{Inputs: []input{}}
+	err := run(opts, summary)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		summary.Category = categoryInternal
+		var failure *runError
+		if errors.As(err, &failure) {
+			summary.Category = failure.category
+		}
+		summary.Error = err.Error()
+	}
+
+	if err := summary.write(terminationLogPath); err != nil {
+		fmt.Printf("Error writing termination message: %v\n", err)
+	}
 	if err != nil {
-		panic(fmt.Errorf("error reading schedule URLs: %w", err))
+		os.Exit(1)
+	}
+}
+
+// run downloads, verifies and prepares all inputs of the import. The fetched
+// inputs are recorded in summary, also if run fails.
+func run(opts options, summary *report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	osmDataFolder := opts.inputDir
+	schedulesDataPath := filepath.Join(opts.inputDir, schedulesDataDir)
+	importConfigPath := filepath.Join(opts.inputDir, importConfigFile)
+	validationReportPath := filepath.Join(opts.inputDir, validationReportFile)
+	manifestPath := filepath.Join(opts.inputDir, manifestFile)
+
+	if err := installWrapper(toolsPath); err != nil {
+		return fail(categoryInternal, fmt.Errorf("error installing wrapper: %w", err))
+	}
+
+	hosts, err := readCredentials(credentialsPath)
+	if err != nil {
+		return fail(categoryConfig, fmt.Errorf("error reading credentials: %w", err))
+	}
+	downloader := newDownloader(opts.retries, opts.requestTimeout, hosts)
+
+	schedules, err := readSources(schedulesConfigPath)
+	if err != nil {
+		return fail(categoryConfig, fmt.Errorf("error reading schedule URLs: %w", err))
+	}
+	maps, err := readSources(osmConfigPath)
+	if err != nil {
+		return fail(categoryConfig, fmt.Errorf("error reading osm URLs: %w", err))
 	}
 
-	fmt.Println("Downloading schedules...")
 	tmpDir, err := script.Exec("mktemp -d").String()
 	if err != nil {
-		panic(fmt.Errorf("error creating tmp directory: %w", err))
+		return fail(categoryInternal, fmt.Errorf("error creating tmp directory: %w", err))
 	}
 	tmpDir = strings.Replace(tmpDir, "\n", "", -1)
-	for _, url := range scheduleUrls {
-		script.Exec(fmt.Sprintf("wget -P %v %v", tmpDir, url)).Wait()
+
+	// Every schedule is downloaded into its own directory, as different feeds often share a file name.
+	names := feedNames(schedules)
+	var requests []downloadRequest
+	for i, schedule := range schedules {
+		dir := filepath.Join(tmpDir, names[i])
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fail(categoryInternal, fmt.Errorf("error creating tmp directory: %w", err))
+		}
+		fileName, err := fileNameForUrl(schedule.url)
+		if err != nil {
+			return fail(categoryConfig, err)
+		}
+		requests = append(requests, downloadRequest{url: schedule.url, dir: dir, fileName: fileName})
+	}
+	// The map data shares a directory, so files with the same name are renamed.
+	osmNames, err := osmFileNames(maps)
+	if err != nil {
+		return fail(categoryConfig, err)
+	}
+	for i, osm := range maps {
+		requests = append(requests, downloadRequest{url: osm.url, dir: osmDataFolder, fileName: osmNames[i]})
 	}
-	script.Echo(fmt.Sprintf("Downloaded files to %v", tmpDir)).Stdout()
 
-	_, err = script.ListFiles(tmpDir).Stdout()
+	fmt.Printf("Downloading %d schedule(s) and %d OpenStreetMap file(s)...\n", len(schedules), len(maps))
+	fetches, err := downloader.downloadAll(ctx, requests, opts.concurrency, opts.perHost)
+	summary.addFetches(fetches)
+	if err != nil {
+		var failed downloadErrors
+		if errors.As(err, &failed) {
+			summary.addFailures(failed)
+		}
+		return fail(categoryDownload, err)
+	}
+	scheduleFetches, osmFetches := fetches[:len(schedules)], fetches[len(schedules):]
+
+	inputs := manifest{Sources: []manifestEntry{}}
+	var importPaths []string
+	validation := validationReport{Feeds: []feedValidation{}}
+	for i, name := range names {
+		file := scheduleFetches[i].file
+		verified, err := schedules[i].verify(name, file)
+		if err != nil {
+			return fail(categoryVerification, fmt.Errorf("error verifying schedule: %w", err))
+		}
+		verified = verified.fetchedFrom(schedules[i], scheduleFetches[i])
+		summary.Inputs = append(summary.Inputs, verified)
+
+		feedDir := filepath.Join(schedulesDataPath, name)
+		if err := os.RemoveAll(feedDir); err != nil {
+			return fail(categoryInternal, fmt.Errorf("error cleaning up %v: %w", feedDir, err))
+		}
+		if err := extract(file, feedDir, opts.maxExtractedSize); err != nil {
+			return fail(categoryExtraction, fmt.Errorf("error extracting schedule %v: %w", redactUrl(schedules[i].url), err))
+		}
+		importPaths = append(importPaths, fmt.Sprintf("paths=schedule-%v:%v", name, feedDir))
+		inputs.add(schedules[i], scheduleFetches[i], verified, feedDir)
+
+		if !opts.skipValidation && isGtfsFeed(feedDir) {
+			fmt.Printf("Validating %v\n", feedDir)
+			validation.Feeds = append(validation.Feeds, validateFeed(name, feedDir))
+		}
+	}
+
+	if err := validation.write(validationReportPath); err != nil {
+		return fail(categoryInternal, fmt.Errorf("error writing validation report: %w", err))
+	}
+	summary.Validation = validation.summaries()
+	if validation.failed() {
+		return fail(categoryValidation, fmt.Errorf("schedule validation failed, see %v for details", validationReportPath))
+	}
+
+	for i, osm := range maps {
+		file := osmFetches[i].file
+		verified, err := osm.verify(filepath.Base(file), file)
+		if err != nil {
+			return fail(categoryVerification, fmt.Errorf("error verifying OpenStreetMap data: %w", err))
+		}
+		verified = verified.fetchedFrom(osm, osmFetches[i])
+		summary.Inputs = append(summary.Inputs, verified)
+		importPaths = append(importPaths, fmt.Sprintf("paths=osm:%v", file))
+		inputs.add(osm, osmFetches[i], verified, file)
+	}
+
+	fmt.Printf("Writing manifest to %v\n", manifestPath)
+	if err := inputs.write(manifestPath); err != nil {
+		return fail(categoryInternal, fmt.Errorf("error writing manifest: %w", err))
+	}
+
+	fmt.Printf("Writing import config to %v\n", importConfigPath)
+	if err := writeImportConfig(motisConfigPath, importConfigPath, importPaths); err != nil {
+		return fail(categoryConfig, fmt.Errorf("error writing import config: %w", err))
+	}
+
+	return nil
+}
+
+// installWrapper copies the running binary into dir, if dir exists. The MOTIS
+// container runs the copy with the wrap subcommand.
+func installWrapper(dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(executable)
 	if err != nil {
-		fmt.Printf("Error listing files: %v", err)
+		return err
 	}
-	script.ListFiles(tmpDir).ExecForEach(fmt.Sprintf("unzip {{.}} -d %v", schedulesDataPath)).Stdout()
+	defer source.Close()
 
-	mapUrls, err := script.File(osmConfigPath).Slice()
+	destination, err := os.OpenFile(filepath.Join(dir, "motis-init"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 	if err != nil {
-		panic(fmt.Errorf("error reading osm URLs: %w", err))
+		return err
 	}
 
-	fmt.Println("Downloading OpenStreetMap data...")
-	for _, url := range mapUrls {
-		script.Exec(fmt.Sprintf("wget -P %v %v", osmDataFolder, url)).Wait()
+	_, copyErr := io.Copy(destination, source)
+	if err := destination.Close(); err != nil && copyErr == nil {
+		return err
 	}
+	return copyErr
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestEntry records a single downloaded source.
+type manifestEntry struct {
+	URL         string    `json:"url"`
+	ResolvedURL string    `json:"resolvedUrl"`
+	Status      int       `json:"status"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	ETag        string    `json:"etag,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	// Target is the directory a schedule was extracted to, or the path of a map file.
+	Target string `json:"target"`
+}
+
+// manifest lists everything fetched by the init container. It is written into
+// the input volume next to the downloaded data.
+type manifest struct {
+	Sources []manifestEntry `json:"sources"`
+}
+
+func (m *manifest) add(s source, f fetch, verified input, target string) {
+	m.Sources = append(m.Sources, manifestEntry{
+		URL:         redactUrl(s.url),
+		ResolvedURL: f.resolvedUrl,
+		Status:      f.status,
+		Size:        verified.Size,
+		SHA256:      verified.SHA256,
+		ETag:        f.etag,
+		FetchedAt:   f.fetchedAt,
+		Target:      target,
+	})
+}
+
+func (m manifest) write(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the combined progress of all downloads is printed.
+const progressInterval = 15 * time.Second
+
+// downloadRequest is a single file of a downloadAll batch. The destinations
+// dir/fileName of a batch must be unique, as the downloads run concurrently.
+type downloadRequest struct {
+	url      string
+	dir      string
+	fileName string
+}
+
+// downloadErrors collects the errors of all failed downloads of a batch.
+type downloadErrors []error
+
+func (e downloadErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d download(s) failed: %v", len(e), strings.Join(messages, "; "))
+}
+
+// downloadAll downloads all requests concurrently and returns the completed
+// downloads in the order of requests. At most concurrency downloads run at
+// the same time, and at most perHost of them go to the same host, unless perHost
+// is 0. A failed download does not stop the others. If any download fails, the
+// returned downloadErrors lists every failure.
+func (d *downloader) downloadAll(ctx context.Context, requests []downloadRequest, concurrency int, perHost int) ([]fetch, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	fetches := make([]fetch, len(requests))
+	errs := make([]error, len(requests))
+
+	workers := make(chan struct{}, concurrency)
+	hostSlots := make(map[string]chan struct{})
+	for _, request := range requests {
+		host := hostForUrl(request.url)
+		if _, ok := hostSlots[host]; !ok && perHost > 0 {
+			hostSlots[host] = make(chan struct{}, perHost)
+		}
+	}
+
+	progress := &batchProgress{total: len(requests), bytes: make(map[string]int64)}
+	d.progress = progress
+	defer func() { d.progress = nil }()
+
+	stopReporting := make(chan struct{})
+	reportingDone := make(chan struct{})
+	go func() {
+		defer close(reportingDone)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopReporting:
+				return
+			case <-ticker.C:
+				fmt.Println(progress)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request downloadRequest) {
+			defer wg.Done()
+
+			// Take the host slot first, so downloads waiting for a busy host do not block a worker.
+			if slots, ok := hostSlots[hostForUrl(request.url)]; ok {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			fmt.Printf("Downloading %v\n", redactUrl(request.url))
+			fetches[i], errs[i] = d.download(ctx, request.url, request.dir, request.fileName)
+			progress.finish(request.url, errs[i])
+		}(i, request)
+	}
+	wg.Wait()
+
+	close(stopReporting)
+	<-reportingDone
+	fmt.Println(progress)
+
+	var failed downloadErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fetches, failed
+	}
+
+	return fetches, nil
+}
+
+// hostForUrl returns the host downloads of rawUrl are limited by.
+func hostForUrl(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedUrl.Hostname())
+}
+
+// batchProgress tracks the progress of all downloads of a downloadAll batch.
+type batchProgress struct {
+	mu       sync.Mutex
+	total    int
+	finished int
+	failed   int
+	// bytes holds the number of bytes downloaded so far for each file.
+	bytes map[string]int64
+}
+
+// restart sets the number of bytes downloaded into file, when a download starts
+// from the beginning or resumes at offset.
+func (p *batchProgress) restart(file string, offset int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes[file] = offset
+}
+
+// reader counts the bytes read from r towards the download into file.
+func (p *batchProgress) reader(file string, r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, progress: p, file: file}
+}
+
+func (p *batchProgress) finish(rawUrl string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished++
+	if err != nil {
+		p.failed++
+		fmt.Printf("Download of %v failed: %v\n", redactUrl(rawUrl), err)
+	}
+}
+
+func (p *batchProgress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var bytes int64
+	for _, n := range p.bytes {
+		bytes += n
+	}
+	return fmt.Sprintf("Progress: %d of %d downloads finished, %d failed, %.1f MiB downloaded", p.finished, p.total, p.failed, float64(bytes)/(1<<20))
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress *batchProgress
+	file     string
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.progress.mu.Lock()
+	r.progress.bytes[r.file] += int64(n)
+	r.progress.mu.Unlock()
+	return n, err
+}
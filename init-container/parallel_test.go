@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadAllLimitsRequestsPerHost(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := map[string]int{}, map[string]int{}
+	total, maxTotal := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, _ := net.SplitHostPort(req.Host)
+		mu.Lock()
+		active[host]++
+		total++
+		if active[host] > maxActive[host] {
+			maxActive[host] = active[host]
+		}
+		if total > maxTotal {
+			maxTotal = total
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "feed")
+
+		mu.Lock()
+		active[host]--
+		total--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// The server is reached under two host names, which are limited separately.
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	dir := t.TempDir()
+	var requests []downloadRequest
+	for i := 0; i < 6; i++ {
+		for _, host := range []string{"127.0.0.1", "localhost"} {
+			requests = append(requests, downloadRequest{
+				url:      fmt.Sprintf("http://%v:%v/feed-%d.zip", host, port, i),
+				dir:      dir,
+				fileName: fmt.Sprintf("%v-%d.zip", host, i),
+			})
+		}
+	}
+
+	d := newDownloader(0, time.Minute, nil)
+	fetches, err := d.downloadAll(context.Background(), requests, 4, 2)
+	if err != nil {
+		t.Fatalf("downloadAll() error = %v", err)
+	}
+
+	for host, max := range maxActive {
+		if max > 2 {
+			t.Errorf("downloadAll() sent %d concurrent requests to %v, want at most 2", max, host)
+		}
+	}
+	if maxTotal > 4 || maxTotal <= 2 {
+		t.Errorf("downloadAll() sent %d concurrent requests, want more than the limit of one host and at most 4", maxTotal)
+	}
+	for i, fetch := range fetches {
+		if !strings.HasSuffix(fetch.file, requests[i].fileName) {
+			t.Errorf("downloadAll() fetch %d = %v, want %v in the order of the requests", i, fetch.file, requests[i].fileName)
+		}
+	}
+}
+
+func TestDownloadAllCollectsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/missing") {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, "feed")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	requests := []downloadRequest{
+		{url: server.URL + "/missing-1.zip", dir: dir, fileName: "missing-1.zip"},
+		{url: server.URL + "/avv.zip", dir: dir, fileName: "avv.zip"},
+		{url: server.URL + "/missing-2.zip", dir: dir, fileName: "missing-2.zip"},
+	}
+
+	d := newDownloader(0, time.Minute, nil)
+	fetches, err := d.downloadAll(context.Background(), requests, 2, 0)
+
+	var failed downloadErrors
+	if !errors.As(err, &failed) || len(failed) != 2 {
+		t.Fatalf("downloadAll() error = %v, want the two failed downloads", err)
+	}
+	if !strings.HasPrefix(err.Error(), "2 download(s) failed: ") || !strings.Contains(err.Error(), "; ") {
+		t.Errorf("downloadAll() error = %q, want both failures in one message", err)
+	}
+	if fetches[1].file == "" {
+		t.Errorf("downloadAll() did not complete the download of %v next to the failed ones", requests[1].url)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+const terminationLogPath = "/dev/termination-log"
+
+// Kubernetes truncates termination messages longer than this.
+const maxTerminationMessageSize = 4096
+
+// input describes a downloaded and verified file.
+type input struct {
+	Name      string    `json:"name"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	URL       string    `json:"url,omitempty"`
+	ETag      string    `json:"etag,omitempty"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// fetchedFrom adds the details of the download of s, which are also listed in the manifest.
+func (i input) fetchedFrom(s source, f fetch) input {
+	i.URL = redactUrl(s.url)
+	i.ETag = f.etag
+	i.FetchedAt = f.fetchedAt
+	return i
+}
+
+// report summarizes the run of the init container. It is written to the
+// termination log, where the operator picks it up.
+type report struct {
+	Inputs     []input       `json:"inputs"`
+	Validation []feedSummary `json:"validation,omitempty"`
+	// Sources is the number of fetched sources and Bytes their combined size.
+	Sources int   `json:"sources"`
+	Bytes   int64 `json:"bytes"`
+	// Failures lists the errors of all failed downloads.
+	Failures []string `json:"failures,omitempty"`
+	// Category and Error describe why the run failed.
+	Category string `json:"category,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Truncated is set if entries had to be left out to fit into the termination message.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func (r *report) addFetches(fetches []fetch) {
+	for _, f := range fetches {
+		if f.file != "" {
+			r.Sources++
+			r.Bytes += f.size
+		}
+	}
+}
+
+func (r *report) addFailures(failures downloadErrors) {
+	for _, err := range failures {
+		r.Failures = append(r.Failures, err.Error())
+	}
+}
+
+func (r report) write(path string) error {
+	return writeTerminationMessage(path, &r, func() bool {
+		switch {
+		case len(r.Inputs) > 0:
+			r.Inputs = r.Inputs[:len(r.Inputs)-1]
+		case len(r.Validation) > 0:
+			r.Validation = r.Validation[:len(r.Validation)-1]
+		case len(r.Failures) > 0:
+			r.Failures = r.Failures[:len(r.Failures)-1]
+		case r.Error != "":
+			r.Error = shorten(r.Error)
+		default:
+			return false
+		}
+		r.Truncated = true
+		return true
+	})
+}
+
+// writeTerminationMessage writes v as JSON to path. As long as the message is
+// too long, shrink is called to leave out details of v. It returns false once
+// nothing is left to leave out.
+func writeTerminationMessage(path string, v interface{}, shrink func() bool) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	for len(message) > maxTerminationMessageSize && shrink() {
+		if message, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, message, 0644)
+}
+
+// shorten cuts message to half of its length.
+func shorten(message string) string {
+	runes := []rune(message)
+	if len(runes) < 4 {
+		return ""
+	}
+	return string(runes[:len(runes)/2]) + "…"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportWrite(t *testing.T) {
+	oversized := report{Category: "DownloadFailed", Error: strings.Repeat("connection reset by peer ", 400)}
+	for i := 0; i < 100; i++ {
+		oversized.Inputs = append(oversized.Inputs, input{Name: fmt.Sprintf("feed-%d", i), SHA256: helloSha256, Size: 5, URL: fmt.Sprintf("https://example.com/feed-%d.zip", i)})
+		oversized.Failures = append(oversized.Failures, fmt.Sprintf("unexpected HTTP status 404 Not Found for https://example.com/missing-%d.zip", i))
+	}
+
+	tests := []struct {
+		name          string
+		report        report
+		wantTruncated bool
+	}{
+		{"small report", report{Inputs: []input{{Name: "avv", SHA256: helloSha256, Size: 5}}, Sources: 1, Bytes: 5}, false},
+		{"oversized report", oversized, true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "termination-log")
+		if err := test.report.write(path); err != nil {
+			t.Fatalf("%v: write() error = %v", test.name, err)
+		}
+
+		message, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(message) > maxTerminationMessageSize {
+			t.Errorf("%v: write() wrote %d bytes, want at most %d", test.name, len(message), maxTerminationMessageSize)
+		}
+
+		var got report
+		if err := json.Unmarshal(message, &got); err != nil {
+			t.Fatalf("%v: write() wrote invalid JSON: %v", test.name, err)
+		}
+		if got.Truncated != test.wantTruncated {
+			t.Errorf("%v: write() truncated = %v, want %v", test.name, got.Truncated, test.wantTruncated)
+		}
+		if got.Category != test.report.Category || got.Sources != test.report.Sources || got.Bytes != test.report.Bytes {
+			t.Errorf("%v: write() left out the summary: %+v", test.name, got)
+		}
+		if !test.wantTruncated && len(got.Inputs) != len(test.report.Inputs) {
+			t.Errorf("%v: write() wrote %d inputs, want %d", test.name, len(got.Inputs), len(test.report.Inputs))
+		}
+	}
+}
+
+func TestCommandReportWrite(t *testing.T) {
+	summary := commandReport{Command: "motis", ExitCode: 1, Duration: "1m0s", Category: "ImportFailed", Error: "exit status 1"}
+	for i := 0; i < maxOutputLines; i++ {
+		summary.Output = append(summary.Output, fmt.Sprintf("line %d: %v", i, strings.Repeat("x", 400)))
+	}
+
+	path := filepath.Join(t.TempDir(), "termination-log")
+	if err := summary.write(path); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	message, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message) > maxTerminationMessageSize {
+		t.Errorf("write() wrote %d bytes, want at most %d", len(message), maxTerminationMessageSize)
+	}
+
+	var got commandReport
+	if err := json.Unmarshal(message, &got); err != nil {
+		t.Fatalf("write() wrote invalid JSON: %v", err)
+	}
+	if !got.Truncated || got.Error != summary.Error {
+		t.Errorf("write() = %+v, want a truncated report with the error", got)
+	}
+	// The last lines are kept, as they usually explain the failure.
+	if len(got.Output) == 0 || len(got.Output) >= maxOutputLines || got.Output[len(got.Output)-1] != summary.Output[maxOutputLines-1] {
+		t.Errorf("write() kept %d output lines, want the last lines of the output", len(got.Output))
+	}
+}
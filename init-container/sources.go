@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/bitfield/script"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// source is an entry of the schedules or osm config. Besides the URL, an entry
+// may list the expected SHA-256 checksum and size of the file:
+//
+//	https://example.com/gtfs.zip sha256=9f86d081884c7d65... size=1048576
+type source struct {
+	url    string
+	sha256 string
+	// size is the expected size in bytes or -1 if it is not known.
+	size int64
+}
+
+// readSources reads the sources listed in a config file, skipping blank lines and comments.
+func readSources(path string) ([]source, error) {
+	lines, err := script.File(path).RejectRegexp(regexp.MustCompile(`^\s*(#|$)`)).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]source, len(lines))
+	for i, line := range lines {
+		if sources[i], err = parseSource(line); err != nil {
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
+
+func parseSource(line string) (source, error) {
+	fields := strings.Fields(line)
+	s := source{url: fields[0], size: -1}
+
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return s, fmt.Errorf("invalid option %q for %v: expected key=value", field, redactUrl(s.url))
+		}
+
+		switch key {
+		case "sha256":
+			value = strings.ToLower(value)
+			if !sha256Pattern.MatchString(value) {
+				return s, fmt.Errorf("invalid sha256 %q for %v", value, redactUrl(s.url))
+			}
+			s.sha256 = value
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return s, fmt.Errorf("invalid size %q for %v", value, redactUrl(s.url))
+			}
+			s.size = size
+		default:
+			return s, fmt.Errorf("unknown option %q for %v", key, redactUrl(s.url))
+		}
+	}
+
+	return s, nil
+}
+
+// verify computes the checksum and size of the downloaded file and compares
+// them to the expected values of the source.
+func (s source) verify(name string, file string) (input, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return input{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return input{}, fmt.Errorf("error hashing %v: %w", file, err)
+	}
+
+	verified := input{
+		Name:   name,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Size:   size,
+	}
+
+	if s.size >= 0 && s.size != verified.Size {
+		return verified, fmt.Errorf("size mismatch for %v: expected %d bytes, got %d bytes", redactUrl(s.url), s.size, verified.Size)
+	}
+	if s.sha256 != "" && s.sha256 != verified.SHA256 {
+		return verified, fmt.Errorf("checksum mismatch for %v: expected sha256 %v, got %v", redactUrl(s.url), s.sha256, verified.SHA256)
+	}
+
+	return verified, nil
+}
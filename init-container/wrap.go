@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The number of output lines of the wrapped command included in the termination message.
+const maxOutputLines = 20
+
+// commandReport summarizes the run of a wrapped command. Like the report of the
+// init run, it is written to the termination log.
+type commandReport struct {
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+	Duration string `json:"duration"`
+	// Category and Error describe why the command failed.
+	Category string `json:"category,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Output holds the last lines the command wrote if it failed.
+	Output []string `json:"output,omitempty"`
+	// Truncated is set if output had to be left out to fit into the termination message.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func (r commandReport) write(path string) error {
+	return writeTerminationMessage(path, &r, func() bool {
+		switch {
+		case len(r.Output) > 0:
+			r.Output = r.Output[1:]
+		case r.Error != "":
+			r.Error = shorten(r.Error)
+		default:
+			return false
+		}
+		r.Truncated = true
+		return true
+	})
+}
+
+// wrap runs the command given in args, usually the MOTIS import, and writes a
+// summary of its run to the termination log. It returns the exit code of the command.
+//
+//	motis-init wrap -- /motis/motis -c /input/config.ini
+func wrap(args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: motis-init wrap -- <command> [arguments...]")
+		return 2
+	}
+
+	start := time.Now()
+	output := &outputTail{}
+	summary := commandReport{Command: filepath.Base(args[0])}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &teeWriter{os.Stdout, output}
+	cmd.Stderr = &teeWriter{os.Stderr, output}
+
+	if err := cmd.Start(); err != nil {
+		summary.ExitCode = 127
+		summary.Category = "StartFailed"
+		summary.Error = err.Error()
+		summary.finish(start)
+		return summary.ExitCode
+	}
+
+	// Pass termination signals on, so the command can shut down cleanly.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for s := range signals {
+			cmd.Process.Signal(s)
+		}
+	}()
+
+	err := cmd.Wait()
+	signal.Stop(signals)
+	close(signals)
+
+	summary.ExitCode = cmd.ProcessState.ExitCode()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			summary.ExitCode = 128 + int(status.Signal())
+			summary.Category = "Killed"
+		} else {
+			summary.Category = "CommandFailed"
+		}
+		summary.Error = fmt.Sprintf("%v: %v", summary.Command, err)
+		summary.Output = output.lines()
+	} else if err != nil {
+		summary.ExitCode = 1
+		summary.Category = "CommandFailed"
+		summary.Error = err.Error()
+	}
+
+	summary.finish(start)
+	return summary.ExitCode
+}
+
+func (r *commandReport) finish(start time.Time) {
+	r.Duration = time.Since(start).Round(time.Second).String()
+	if err := r.write(terminationLogPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing termination message: %v\n", err)
+	}
+}
+
+// teeWriter writes everything to out and keeps a copy in tail.
+type teeWriter struct {
+	out  *os.File
+	tail *outputTail
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	w.tail.write(p)
+	return w.out.Write(p)
+}
+
+// outputTail keeps the last lines written by a command. Stdout and stderr are
+// written concurrently, so access is synchronized.
+type outputTail struct {
+	mu      sync.Mutex
+	partial []byte
+	tail    []string
+}
+
+func (t *outputTail) write(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial = append(t.partial, p...)
+	for {
+		newline := bytes.IndexByte(t.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		t.add(string(t.partial[:newline]))
+		t.partial = t.partial[newline+1:]
+	}
+}
+
+func (t *outputTail) add(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	t.tail = append(t.tail, line)
+	if len(t.tail) > maxOutputLines {
+		t.tail = t.tail[1:]
+	}
+}
+
+func (t *outputTail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.partial) > 0 {
+		t.add(string(t.partial))
+		t.partial = nil
+	}
+	return append([]string(nil), t.tail...)
+}
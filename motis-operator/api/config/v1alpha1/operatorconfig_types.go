@@ -0,0 +1,101 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+//+kubebuilder:object:root=true
+
+// OperatorConfig is the Schema for the controller_manager_config.yaml of the operator.
+// Besides the options of the controller manager, it holds the defaults for Motis and Dataset resources.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// The defaults for fields left unset in Motis and Dataset resources.
+	Defaults Defaults `json:"defaults,omitempty"`
+}
+
+// Defaults are filled into Motis and Dataset resources by the defaulting webhook.
+// Fields left unset fall back to the built-in defaults, see Complete.
+type Defaults struct {
+	// The MOTIS image used to import and serve Datasets.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// The image of the init container, which downloads schedules and map data.
+	// +optional
+	InitImage string `json:"initImage,omitempty"`
+
+	// The port the MOTIS web server listens on.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// The size of the volume holding the downloaded schedules and map data.
+	// +optional
+	InputVolumeSize *resource.Quantity `json:"inputVolumeSize,omitempty"`
+
+	// The size of the volume holding the data imported by MOTIS.
+	// +optional
+	DataVolumeSize *resource.Quantity `json:"dataVolumeSize,omitempty"`
+
+	// The path the volume holding the downloaded schedules and map data is mounted to.
+	// +optional
+	InputMountPath string `json:"inputMountPath,omitempty"`
+
+	// The path the volume holding the data imported by MOTIS is mounted to.
+	// +optional
+	DataMountPath string `json:"dataMountPath,omitempty"`
+}
+
+// Complete returns d with all fields left unset filled in from the built-in defaults.
+func (d Defaults) Complete() Defaults {
+	if d.Image == "" {
+		d.Image = "ghcr.io/motis-project/motis:latest"
+	}
+	if d.InitImage == "" {
+		d.InitImage = "ghcr.io/vstollen/motis-init:0.3.0"
+	}
+	if d.Port == 0 {
+		d.Port = 8080
+	}
+	if d.InputVolumeSize == nil {
+		size := resource.MustParse("10Gi")
+		d.InputVolumeSize = &size
+	}
+	if d.DataVolumeSize == nil {
+		size := resource.MustParse("10Gi")
+		d.DataVolumeSize = &size
+	}
+	if d.InputMountPath == "" {
+		d.InputMountPath = "/input"
+	}
+	if d.DataMountPath == "" {
+		d.DataMountPath = "/data"
+	}
+	return d
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{})
+}
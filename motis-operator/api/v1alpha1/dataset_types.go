@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -31,6 +32,52 @@ type DatasetSpec struct {
 
 	// The config map including config.ini, osm url and schedule url
 	Config *corev1.ConfigMapVolumeSource `json:"config,omitempty"`
+
+	// A secret with credentials for the schedule and map data sources, keyed by host name.
+	// +optional
+	Credentials *corev1.SecretVolumeSource `json:"credentials,omitempty"`
+
+	// The MOTIS image importing the Dataset.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// The MOTIS image serving the Dataset. Defaults to image.
+	// The data format of MOTIS changes between versions, so a Dataset is only served by this image.
+	// +optional
+	ServerImage string `json:"serverImage,omitempty"`
+
+	// The image of the init container, which downloads the schedules and map data.
+	// +optional
+	InitImage string `json:"initImage,omitempty"`
+
+	// Secrets for pulling the images.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// The pull policy of the images.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// The compute resources of the init container, which downloads the schedules and map data.
+	// +optional
+	InitResources corev1.ResourceRequirements `json:"initResources,omitempty"`
+
+	// The compute resources of the MOTIS import.
+	// +optional
+	ImportResources corev1.ResourceRequirements `json:"importResources,omitempty"`
+
+	// Overrides for the pods importing the Dataset.
+	// +optional
+	PodOverrides *PodOverrides `json:"podOverrides,omitempty"`
+
+	// The volume holding the downloaded schedules and map data.
+	// +optional
+	InputVolume *VolumeSpec `json:"inputVolume,omitempty"`
+
+	// The volume holding the data imported by MOTIS.
+	// +optional
+	DataVolume *VolumeSpec `json:"dataVolume,omitempty"`
 }
 
 // DatasetStatus defines the observed state of Dataset
@@ -38,7 +85,19 @@ type DatasetStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	Conditions []DatasetCondition `json:"conditions"`
+	// The current processing phase of the Dataset.
+	// +optional
+	Phase DatasetPhase `json:"phase,omitempty"`
+
+	// The phases the Dataset went through, in order, together with the time each phase started.
+	// +optional
+	PhaseHistory []DatasetPhaseTransition `json:"phaseHistory,omitempty"`
+
+	// Conditions of the Dataset, one of Ready, Progressing or Failed.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	// A pointer to the pvc of the Motis input volume.
 	// +optional
@@ -46,24 +105,88 @@ type DatasetStatus struct {
 
 	// A pointer to the pvc of the Motis data volume.
 	DataVolume *corev1.VolumeSource `json:"dataVolume,omitempty"`
+
+	// The schedules and map data downloaded for the Dataset, as verified by the init container.
+	// +optional
+	Inputs []DatasetInput `json:"inputs,omitempty"`
+
+	// InputsTruncated is set if the init container had to leave out inputs to fit its report
+	// into the termination message. The complete list is in manifest.json on the input volume.
+	// +optional
+	InputsTruncated bool `json:"inputsTruncated,omitempty"`
+
+	// The combined size of all downloaded inputs in bytes. Unlike Inputs, it is never truncated.
+	// +optional
+	InputsSize int64 `json:"inputsSize,omitempty"`
+
+	// The digest of the MOTIS image which imported the Dataset, e.g. sha256:9f86d081884c7d65...
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
 }
 
-type DatasetConditionType string
+// DatasetInput describes a downloaded input file of a Dataset.
+type DatasetInput struct {
+	// Name of the input. Schedules are named after their directory, map data after its file.
+	Name string `json:"name"`
+
+	// The hex encoded SHA-256 checksum of the downloaded file.
+	SHA256 string `json:"sha256"`
+
+	// Size of the downloaded file in bytes.
+	Size int64 `json:"size"`
+
+	// The URL the input was downloaded from, without credentials.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// The ETag the server returned for the input.
+	// +optional
+	ETag string `json:"etag,omitempty"`
+
+	// The time the download of the input finished.
+	// +optional
+	FetchedAt *metav1.Time `json:"fetchedAt,omitempty"`
+}
+
+// DatasetPhase is a step in the processing of a Dataset.
+// +kubebuilder:validation:Enum=Pending;Provisioning;Downloading;Importing;Ready;Failed
+type DatasetPhase string
 
 const (
-	// DatasetReady means the Dataset has finished its processing
-	DatasetReady DatasetConditionType = "Ready"
+	// DatasetPending means no resources have been created for the Dataset yet
+	DatasetPending DatasetPhase = "Pending"
+	// DatasetProvisioning means the volumes of the Dataset are being created and bound
+	DatasetProvisioning DatasetPhase = "Provisioning"
+	// DatasetDownloading means the init container downloads the schedules and map data
+	DatasetDownloading DatasetPhase = "Downloading"
+	// DatasetImporting means MOTIS imports the downloaded data
+	DatasetImporting DatasetPhase = "Importing"
+	// DatasetPhaseReady means the Dataset can be served
+	DatasetPhaseReady DatasetPhase = "Ready"
+	// DatasetPhaseFailed means the processing of the Dataset failed and will not be retried
+	DatasetPhaseFailed DatasetPhase = "Failed"
 )
 
-type DatasetCondition struct {
-	// Type of job condition, Complete or Failed.
-	Type DatasetConditionType `json:"type"`
-	// Status of the condition, one of True, False, Unknown.
-	Status corev1.ConditionStatus `json:"status" protobuf:"bytes,2,opt,name=status,casttype=k8s.io/api/core/v1.ConditionStatus"`
+// DatasetPhaseTransition records when a Dataset entered a phase.
+type DatasetPhaseTransition struct {
+	Phase     DatasetPhase `json:"phase"`
+	StartTime metav1.Time  `json:"startTime"`
 }
 
+const (
+	// DatasetReady means the Dataset has finished its processing
+	DatasetReady = "Ready"
+	// DatasetProgressing means the volumes, download or import of the Dataset are in progress
+	DatasetProgressing = "Progressing"
+	// DatasetFailed means the processing of the Dataset failed and will not be retried
+	DatasetFailed = "Failed"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Progressing")].reason`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Dataset is the Schema for the datasets API
 type Dataset struct {
@@ -75,13 +198,11 @@ type Dataset struct {
 }
 
 func (d *Dataset) HasFinishedProcessing() bool {
-	for _, condition := range d.Status.Conditions {
-		if condition.Type == DatasetReady {
-			return condition.Status == corev1.ConditionTrue
-		}
-	}
+	return meta.IsStatusConditionTrue(d.Status.Conditions, DatasetReady)
+}
 
-	return false
+func (d *Dataset) HasFailed() bool {
+	return meta.IsStatusConditionTrue(d.Status.Conditions, DatasetFailed)
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	configv1alpha1 "github.com/vstollen/motis-operator/api/config/v1alpha1"
+)
+
+// log is for logging in this package.
+var datasetlog = logf.Log.WithName("dataset-resource")
+
+func (r *Dataset) SetupWebhookWithManager(mgr ctrl.Manager, defaults configv1alpha1.Defaults) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&datasetDefaulter{defaults: defaults}).
+		WithValidator(&datasetValidator{client: mgr.GetAPIReader()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-motis-motis-project-de-v1alpha1-dataset,mutating=true,failurePolicy=fail,sideEffects=None,groups=motis.motis-project.de,resources=datasets,verbs=create,versions=v1alpha1,name=mdataset.kb.io,admissionReviewVersions=v1
+
+// datasetDefaulter fills in the defaults configured for the operator. The spec
+// of a Dataset is immutable, so it is only defaulted on creation.
+type datasetDefaulter struct {
+	defaults configv1alpha1.Defaults
+}
+
+var _ webhook.CustomDefaulter = &datasetDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *datasetDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	dataset, ok := obj.(*Dataset)
+	if !ok {
+		return fmt.Errorf("expected a Dataset but got a %T", obj)
+	}
+	datasetlog.Info("default", "name", dataset.Name)
+
+	dataset.Spec.SetDefaults(d.defaults)
+	return nil
+}
+
+// SetDefaults fills the fields left unset from defaults. The controllers call it as
+// well, so resources admitted without the webhook get the same defaults.
+func (s *DatasetSpec) SetDefaults(defaults configv1alpha1.Defaults) {
+	if s.Image == "" {
+		s.Image = defaults.Image
+	}
+	if s.ServerImage == "" {
+		s.ServerImage = s.Image
+	}
+	if s.InitImage == "" {
+		s.InitImage = defaults.InitImage
+	}
+	s.InputVolume = defaultVolume(s.InputVolume, defaults.InputVolumeSize, defaults.InputMountPath)
+	s.DataVolume = defaultVolume(s.DataVolume, defaults.DataVolumeSize, defaults.DataMountPath)
+}
+
+//+kubebuilder:webhook:path=/validate-motis-motis-project-de-v1alpha1-dataset,mutating=false,failurePolicy=fail,sideEffects=None,groups=motis.motis-project.de,resources=datasets,verbs=create;update,versions=v1alpha1,name=vdataset.kb.io,admissionReviewVersions=v1
+
+// datasetValidator validates Dataset resources. It needs a client to check that
+// referenced config maps exist.
+type datasetValidator struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &datasetValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *datasetValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	dataset, ok := obj.(*Dataset)
+	if !ok {
+		return fmt.Errorf("expected a Dataset but got a %T", obj)
+	}
+	datasetlog.Info("validate create", "name", dataset.Name)
+
+	errs, err := validateConfigMap(ctx, v.client, field.NewPath("spec").Child("config"), dataset.Namespace, dataset.Spec.Config)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Dataset").GroupKind(), dataset.Name, errs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type.
+// A Dataset is built once from its spec, so the spec cannot change afterwards.
+func (v *datasetValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldDataset, ok := oldObj.(*Dataset)
+	if !ok {
+		return fmt.Errorf("expected a Dataset but got a %T", oldObj)
+	}
+	dataset, ok := newObj.(*Dataset)
+	if !ok {
+		return fmt.Errorf("expected a Dataset but got a %T", newObj)
+	}
+	datasetlog.Info("validate update", "name", dataset.Name)
+
+	if reflect.DeepEqual(oldDataset.Spec, dataset.Spec) {
+		return nil
+	}
+
+	errs := field.ErrorList{field.Forbidden(field.NewPath("spec"), "the spec of a Dataset is immutable")}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Dataset").GroupKind(), dataset.Name, errs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *datasetValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
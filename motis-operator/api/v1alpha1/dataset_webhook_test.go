@@ -0,0 +1,53 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Dataset webhook", func() {
+	It("rejects changes to the spec", func() {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "dataset-config", Namespace: "default"},
+			Data:       map[string]string{"schedules": "https://example.com/gtfs.zip\n"},
+		}
+		Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+
+		dataset := &Dataset{
+			ObjectMeta: metav1.ObjectMeta{Name: "immutable", Namespace: "default"},
+			Spec: DatasetSpec{
+				Config: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, dataset)).To(Succeed())
+
+		dataset.Labels = map[string]string{"changed": "metadata"}
+		Expect(k8sClient.Update(ctx, dataset)).To(Succeed())
+
+		dataset.Spec.Config.Name = "other-config"
+		err := k8sClient.Update(ctx, dataset)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "%v", err)
+		Expect(err.Error()).To(ContainSubstring("immutable"))
+	})
+})
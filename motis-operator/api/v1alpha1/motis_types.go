@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,20 +31,427 @@ type MotisSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// The Input Volume containing schedule, map data, etc.
+	// Ignored if any of schedules, osm, modules or rawConfig is set.
 	Config *corev1.ConfigMapVolumeSource `json:"config,omitempty"`
 
+	// The schedules imported by MOTIS.
+	// +optional
+	Schedules []Source `json:"schedules,omitempty"`
+
+	// The OpenStreetMap data imported by MOTIS.
+	// +optional
+	OSM []Source `json:"osm,omitempty"`
+
+	// The MOTIS modules to enable.
+	// +optional
+	Modules []ModuleSpec `json:"modules,omitempty"`
+
+	// Additional lines for config.ini, for options not covered by the other fields.
+	// Sections are merged with the sections rendered from modules.
+	// +optional
+	RawConfig string `json:"rawConfig,omitempty"`
+
+	// A secret with credentials for the schedule and map data sources.
+	// Each key is a host name and its value contains one credential per line,
+	// either bearer=<token>, basic=<username>:<password> or header=<name>: <value>.
+	// +optional
+	Credentials *corev1.SecretVolumeSource `json:"credentials,omitempty"`
+
 	// +optional
 	UpdateSchedule string `json:"updateSchedule,omitempty"`
+
+	// The MOTIS image serving the Datasets.
+	// Defaults to the image configured for the operator.
+	// Changing an image builds a new Dataset, which is served once it is ready.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// The MOTIS image importing the Datasets. Defaults to image.
+	// If both are the same, the server is pinned to the digest of the image which imported the served Dataset.
+	// +optional
+	ProcessingImage string `json:"processingImage,omitempty"`
+
+	// The image of the init container, which downloads the schedules and map data.
+	// Defaults to the init image configured for the operator.
+	// +optional
+	InitImage string `json:"initImage,omitempty"`
+
+	// Secrets for pulling the images.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// The pull policy of the images.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// The port the MOTIS web server listens on.
+	// Defaults to the port configured for the operator.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// The compute resources of the MOTIS server.
+	// +optional
+	ServerResources corev1.ResourceRequirements `json:"serverResources,omitempty"`
+
+	// The compute resources of the init container, which downloads the schedules and map data.
+	// +optional
+	InitResources corev1.ResourceRequirements `json:"initResources,omitempty"`
+
+	// The compute resources of the MOTIS import.
+	// +optional
+	ImportResources corev1.ResourceRequirements `json:"importResources,omitempty"`
+
+	// Overrides for the pods of the MOTIS server.
+	// +optional
+	ServerPodOverrides *PodOverrides `json:"serverPodOverrides,omitempty"`
+
+	// Overrides for the pods importing the Datasets.
+	// +optional
+	ProcessingPodOverrides *PodOverrides `json:"processingPodOverrides,omitempty"`
+
+	// The Service exposing the MOTIS web interface. It is named after the Motis.
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// An Ingress for the MOTIS web interface. No Ingress is created if unset.
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Overrides for the startup probe of the MOTIS server. By default, the server gets
+	// 10 minutes plus one minute per 100MiB of downloaded schedules and map data to load
+	// its Dataset.
+	// +optional
+	StartupProbe *ProbeSpec `json:"startupProbe,omitempty"`
+
+	// Overrides for the readiness probe of the MOTIS server.
+	// +optional
+	ReadinessProbe *ProbeSpec `json:"readinessProbe,omitempty"`
+
+	// Overrides for the liveness probe of the MOTIS server.
+	// +optional
+	LivenessProbe *ProbeSpec `json:"livenessProbe,omitempty"`
+
+	// How long the Deployment of the previous Dataset is kept after switching to a new
+	// Dataset, so in-flight requests can finish. Defaults to 5m.
+	// +optional
+	SwitchoverGracePeriod *metav1.Duration `json:"switchoverGracePeriod,omitempty"`
+
+	// The name of a Dataset of this Motis to serve instead of the latest one. Scheduled
+	// updates keep building new Datasets, but they are not served while a Dataset is pinned.
+	// The rollback-requested annotation pins the Dataset before the current one.
+	// +optional
+	PinnedDataset string `json:"pinnedDataset,omitempty"`
+
+	// Which old Datasets are kept. Datasets that are deleted take their volumes with them.
+	// +optional
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+
+	// The volume of each Dataset holding the downloaded schedules and map data.
+	// +optional
+	InputVolume *VolumeSpec `json:"inputVolume,omitempty"`
+
+	// The volume of each Dataset holding the data imported by MOTIS.
+	// +optional
+	DataVolume *VolumeSpec `json:"dataVolume,omitempty"`
+}
+
+// RetentionPolicy limits the Datasets kept for a Motis. The latest Dataset and the
+// Datasets being served are never deleted.
+type RetentionPolicy struct {
+	// The number of Datasets that finished processing to keep. Defaults to 2,
+	// so the previous Dataset remains available.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KeepReady *int32 `json:"keepReady,omitempty"`
+
+	// How long failed Datasets are kept for inspection, e.g. 24h. Defaults to 24h.
+	// +optional
+	KeepFailedFor *metav1.Duration `json:"keepFailedFor,omitempty"`
+
+	// The maximum total size of the volumes of all Datasets. The oldest Datasets are
+	// deleted until the volumes fit. Unlimited if unset.
+	// +optional
+	MaxTotalSize *resource.Quantity `json:"maxTotalSize,omitempty"`
+}
+
+// ServiceSpec configures the Service exposing the MOTIS web interface.
+type ServiceSpec struct {
+	// The type of the Service. Defaults to ClusterIP.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// The port of the Service. Defaults to 80.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// The node port of a NodePort or LoadBalancer Service. Allocated by Kubernetes if unset.
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// Annotations added to the Service, e.g. to configure a load balancer.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IngressSpec configures the Ingress for the MOTIS web interface.
+type IngressSpec struct {
+	// The host name of the Ingress.
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// The path prefix of the Ingress. Defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// The secret with the TLS certificate for host. TLS is disabled if unset.
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// The IngressClass of the Ingress. The default class is used if unset.
+	// +optional
+	ClassName *string `json:"className,omitempty"`
+
+	// Annotations added to the Ingress.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ProbeSpec overrides the thresholds of a probe against the MOTIS web interface.
+// Fields left unset keep the values chosen by the operator.
+type ProbeSpec struct {
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// PodOverrides are merged into the pod template generated by the operator with a strategic merge patch.
+type PodOverrides struct {
+	// Labels added to the pods. Labels set by the operator take precedence.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations added to the pods.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// The security context of the pods, e.g. to set the fsGroup of the volumes.
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// The security context of every container in the pods.
+	// +optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// VolumeSpec describes a persistent volume claimed for a Dataset.
+type VolumeSpec struct {
+	// The requested size of the volume.
+	// Defaults to the size configured for the operator.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// The storage class of the volume. The default storage class is used if unset.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// The access modes of the volume. Defaults to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// The path the volume is mounted to in the MOTIS containers.
+	// Defaults to the mount path configured for the operator.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// Source is a schedule or OpenStreetMap file downloaded for the import.
+type Source struct {
+	// The URL to download the file from.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// The expected hex encoded SHA-256 checksum of the file.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{64}$`
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+
+	// The expected size of the file in bytes.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Size *int64 `json:"size,omitempty"`
+}
+
+// ModuleSpec enables a MOTIS module.
+type ModuleSpec struct {
+	// The name of the module, e.g. routing or intermodal.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Settings of the module, rendered into its section of config.ini.
+	// A key may be listed multiple times.
+	// +optional
+	Settings []ModuleSetting `json:"settings,omitempty"`
+}
+
+// ModuleSetting is a single option of a MOTIS module.
+type ModuleSetting struct {
+	// +kubebuilder:validation:MinLength=1
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 // MotisStatus defines the observed state of Motis
 type MotisStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Conditions of the Motis, one of Ready, Updating or Degraded.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The name of the Dataset currently served.
+	// +optional
+	CurrentDataset string `json:"currentDataset,omitempty"`
+
+	// The name of the newest Dataset that finished processing before the current one.
+	// A rollback pins it, so repeated rollbacks move further back.
+	// +optional
+	PreviousDataset string `json:"previousDataset,omitempty"`
+
+	// Pinned is set while spec.pinnedDataset overrides the latest Dataset.
+	// +optional
+	Pinned bool `json:"pinned,omitempty"`
+
+	// The name of the newest Dataset, which may still be processing.
+	// +optional
+	LatestDataset string `json:"latestDataset,omitempty"`
+
+	// The last time a new Dataset started being served.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+
+	// The next time the update schedule checks for updates.
+	// +optional
+	NextUpdateTime *metav1.Time `json:"nextUpdateTime,omitempty"`
+
+	// The in-cluster URL of the MOTIS web interface.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// The external URL of the MOTIS web interface, if it is exposed by an Ingress or a LoadBalancer Service.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// The sources of the latest Dataset, as seen when it was created.
+	// Used to skip scheduled updates if no source changed.
+	// +optional
+	Sources []SourceStatus `json:"sources,omitempty"`
+
+	// The last time the update schedule triggered a check for updates.
+	// +optional
+	LastUpdateCheck *metav1.Time `json:"lastUpdateCheck,omitempty"`
+
+	// The last time a scheduled update was skipped because none of the sources changed.
+	// +optional
+	LastSkippedUpdate *metav1.Time `json:"lastSkippedUpdate,omitempty"`
+
+	// The token of the last rebuild-requested annotation a Dataset was created for.
+	// +optional
+	LastHandledRebuildToken string `json:"lastHandledRebuildToken,omitempty"`
+
+	// The processing, server and init image, separated by spaces, a Dataset was last created
+	// for because the images changed. Prevents creating a second Dataset for the same change.
+	// +optional
+	LastImageRebuild string `json:"lastImageRebuild,omitempty"`
+}
+
+const (
+	// MotisReady means a Dataset is served by an available deployment
+	MotisReady = "Ready"
+	// MotisUpdating means a newer Dataset than the served one is processing
+	MotisUpdating = "Updating"
+	// MotisDegraded means the latest Dataset failed or the deployment is unavailable
+	MotisDegraded = "Degraded"
+)
+
+const (
+	// RollbackAnnotation requests pinning status.previousDataset. The operator
+	// removes the annotation once it set spec.pinnedDataset.
+	RollbackAnnotation = "motis-project.de/rollback-requested"
+	// RebuildRequestedAnnotation requests a new Dataset. Its value is a token, e.g. a
+	// timestamp or a CI build number. Each token creates exactly one Dataset.
+	RebuildRequestedAnnotation = "motis-project.de/rebuild-requested"
+	// RebuildTokenAnnotation records on a Dataset the rebuild token pending at its creation.
+	RebuildTokenAnnotation = "motis-project.de/rebuild-token"
+)
+
+// SourceStatus holds the HTTP validators of a schedule or OpenStreetMap source.
+type SourceStatus struct {
+	// The URL of the source, without credentials and query.
+	URL string `json:"url"`
+
+	// The hex encoded SHA-256 hash of the complete URL, which identifies the source.
+	// +optional
+	URLHash string `json:"urlHash,omitempty"`
+
+	// The ETag header returned for the source.
+	// +optional
+	ETag string `json:"etag,omitempty"`
+
+	// The Last-Modified header returned for the source.
+	// +optional
+	LastModified string `json:"lastModified,omitempty"`
+
+	// The Content-Length header returned for the source.
+	// +optional
+	ContentLength int64 `json:"contentLength,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Updating",type=string,JSONPath=`.status.conditions[?(@.type=="Updating")].status`
+//+kubebuilder:printcolumn:name="Current",type=string,JSONPath=`.status.currentDataset`
+//+kubebuilder:printcolumn:name="Pinned",type=boolean,JSONPath=`.status.pinned`
+//+kubebuilder:printcolumn:name="Latest",type=string,JSONPath=`.status.latestDataset`
+//+kubebuilder:printcolumn:name="Last Update",type=date,JSONPath=`.status.lastUpdateTime`
+//+kubebuilder:printcolumn:name="Next Update",type=string,JSONPath=`.status.nextUpdateTime`,priority=1
+//+kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.endpoint`,priority=1
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Motis is the Schema for the motis API
 type Motis struct {
@@ -54,6 +462,12 @@ type Motis struct {
 	Status MotisStatus `json:"status,omitempty"`
 }
 
+// HasTypedConfig returns whether the config of the Motis is rendered by the
+// operator from the typed fields instead of taken from Config.
+func (m *Motis) HasTypedConfig() bool {
+	return len(m.Spec.Schedules) > 0 || len(m.Spec.OSM) > 0 || len(m.Spec.Modules) > 0 || m.Spec.RawConfig != ""
+}
+
 //+kubebuilder:object:root=true
 
 // MotisList contains a list of Motis
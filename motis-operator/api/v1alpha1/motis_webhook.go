@@ -0,0 +1,289 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	configv1alpha1 "github.com/vstollen/motis-operator/api/config/v1alpha1"
+)
+
+// log is for logging in this package.
+var motislog = logf.Log.WithName("motis-resource")
+
+// The keys of a config map listing the schedule and OpenStreetMap URLs, one per line.
+var sourceConfigKeys = []string{"schedules", "osm"}
+
+func (r *Motis) SetupWebhookWithManager(mgr ctrl.Manager, defaults configv1alpha1.Defaults) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&motisDefaulter{defaults: defaults}).
+		WithValidator(&motisValidator{client: mgr.GetAPIReader()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-motis-motis-project-de-v1alpha1-motis,mutating=true,failurePolicy=fail,sideEffects=None,groups=motis.motis-project.de,resources=motis,verbs=create;update,versions=v1alpha1,name=mmotis.kb.io,admissionReviewVersions=v1
+
+// motisDefaulter fills in the defaults configured for the operator.
+type motisDefaulter struct {
+	defaults configv1alpha1.Defaults
+}
+
+var _ webhook.CustomDefaulter = &motisDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *motisDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	motis, ok := obj.(*Motis)
+	if !ok {
+		return fmt.Errorf("expected a Motis but got a %T", obj)
+	}
+	motislog.Info("default", "name", motis.Name)
+
+	motis.Spec.SetDefaults(d.defaults)
+	return nil
+}
+
+// SetDefaults fills the fields left unset from defaults. The controllers call it as
+// well, so resources admitted without the webhook get the same defaults.
+func (s *MotisSpec) SetDefaults(defaults configv1alpha1.Defaults) {
+	if s.Image == "" {
+		s.Image = defaults.Image
+	}
+	if s.InitImage == "" {
+		s.InitImage = defaults.InitImage
+	}
+	if s.Port == 0 {
+		s.Port = defaults.Port
+	}
+	s.InputVolume = defaultVolume(s.InputVolume, defaults.InputVolumeSize, defaults.InputMountPath)
+	s.DataVolume = defaultVolume(s.DataVolume, defaults.DataVolumeSize, defaults.DataMountPath)
+
+	if s.Service == nil {
+		s.Service = &ServiceSpec{}
+	}
+	if s.Service.Type == "" {
+		s.Service.Type = corev1.ServiceTypeClusterIP
+	}
+	if s.Service.Port == 0 {
+		s.Service.Port = 80
+	}
+	if s.Ingress != nil && s.Ingress.Path == "" {
+		s.Ingress.Path = "/"
+	}
+	if s.Retention == nil {
+		s.Retention = &RetentionPolicy{}
+	}
+	if s.Retention.KeepReady == nil {
+		keepReady := int32(2)
+		s.Retention.KeepReady = &keepReady
+	}
+	if s.Retention.KeepFailedFor == nil {
+		s.Retention.KeepFailedFor = &metav1.Duration{Duration: 24 * time.Hour}
+	}
+	if s.SwitchoverGracePeriod == nil {
+		s.SwitchoverGracePeriod = &metav1.Duration{Duration: 5 * time.Minute}
+	}
+}
+
+// defaultVolume returns volume with its size and mount path defaulted to size and mountPath,
+// and its access modes to ReadWriteOnce.
+func defaultVolume(volume *VolumeSpec, size *resource.Quantity, mountPath string) *VolumeSpec {
+	if volume == nil {
+		volume = &VolumeSpec{}
+	}
+	if volume.Size == nil && size != nil {
+		defaultSize := size.DeepCopy()
+		volume.Size = &defaultSize
+	}
+	if len(volume.AccessModes) == 0 {
+		volume.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	if volume.MountPath == "" {
+		volume.MountPath = mountPath
+	}
+	return volume
+}
+
+//+kubebuilder:webhook:path=/validate-motis-motis-project-de-v1alpha1-motis,mutating=false,failurePolicy=fail,sideEffects=None,groups=motis.motis-project.de,resources=motis,verbs=create;update,versions=v1alpha1,name=vmotis.kb.io,admissionReviewVersions=v1
+
+// motisValidator validates Motis resources. It needs a client to check that
+// referenced config maps exist.
+type motisValidator struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &motisValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *motisValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	motis, ok := obj.(*Motis)
+	if !ok {
+		return fmt.Errorf("expected a Motis but got a %T", obj)
+	}
+	motislog.Info("validate create", "name", motis.Name)
+
+	return v.validate(ctx, motis)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *motisValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	motis, ok := newObj.(*Motis)
+	if !ok {
+		return fmt.Errorf("expected a Motis but got a %T", newObj)
+	}
+	motislog.Info("validate update", "name", motis.Name)
+
+	return v.validate(ctx, motis)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *motisValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *motisValidator) validate(ctx context.Context, motis *Motis) error {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if motis.Spec.UpdateSchedule != "" {
+		if _, err := cron.ParseStandard(motis.Spec.UpdateSchedule); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("updateSchedule"), motis.Spec.UpdateSchedule, err.Error()))
+		}
+	}
+
+	if service := motis.Spec.Service; service != nil && service.NodePort != 0 && service.Type != corev1.ServiceTypeNodePort && service.Type != corev1.ServiceTypeLoadBalancer {
+		errs = append(errs, field.Invalid(specPath.Child("service", "nodePort"), service.NodePort, "a node port requires a Service of type NodePort or LoadBalancer"))
+	}
+	if ingress := motis.Spec.Ingress; ingress != nil && ingress.Path != "" && !strings.HasPrefix(ingress.Path, "/") {
+		errs = append(errs, field.Invalid(specPath.Child("ingress", "path"), ingress.Path, "the path must start with /"))
+	}
+
+	if motis.Spec.PinnedDataset != "" {
+		pinnedErrs, err := validatePinnedDataset(ctx, v.client, specPath.Child("pinnedDataset"), motis)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, pinnedErrs...)
+	}
+
+	if motis.HasTypedConfig() {
+		for i, source := range motis.Spec.Schedules {
+			errs = append(errs, validateSourceUrl(specPath.Child("schedules").Index(i).Child("url"), source.URL)...)
+		}
+		for i, source := range motis.Spec.OSM {
+			errs = append(errs, validateSourceUrl(specPath.Child("osm").Index(i).Child("url"), source.URL)...)
+		}
+	} else {
+		configErrs, err := validateConfigMap(ctx, v.client, specPath.Child("config"), motis.Namespace, motis.Spec.Config)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, configErrs...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Motis").GroupKind(), motis.Name, errs)
+}
+
+// validatePinnedDataset checks that the Dataset pinned by motis exists and belongs to motis.
+func validatePinnedDataset(ctx context.Context, c client.Reader, path *field.Path, motis *Motis) (field.ErrorList, error) {
+	dataset := &Dataset{}
+	if err := c.Get(ctx, types.NamespacedName{Name: motis.Spec.PinnedDataset, Namespace: motis.Namespace}, dataset); err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(path, motis.Spec.PinnedDataset)}, nil
+		}
+		return nil, err
+	}
+
+	if owner := metav1.GetControllerOf(dataset); owner == nil || owner.UID != motis.UID {
+		return field.ErrorList{field.Invalid(path, motis.Spec.PinnedDataset, "the Dataset does not belong to this Motis")}, nil
+	}
+	if dataset.HasFailed() {
+		return field.ErrorList{field.Invalid(path, motis.Spec.PinnedDataset, "the Dataset failed")}, nil
+	}
+	return nil, nil
+}
+
+// validateConfigMap checks that the config map referenced by config exists and
+// that the source URLs it lists are valid.
+func validateConfigMap(ctx context.Context, c client.Reader, path *field.Path, namespace string, config *corev1.ConfigMapVolumeSource) (field.ErrorList, error) {
+	if config == nil || config.Name == "" {
+		return field.ErrorList{field.Required(path, "either a config map or schedules, osm, modules or rawConfig must be set")}, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Name: config.Name, Namespace: namespace}, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(path.Child("name"), config.Name)}, nil
+		}
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	for _, key := range sourceConfigKeys {
+		key = ConfigMapKeyForPath(config, key)
+		for _, line := range strings.Split(configMap.Data[key], "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			errs = append(errs, validateSourceUrl(path.Child("name").Key(key), strings.Fields(line)[0])...)
+		}
+	}
+
+	return errs, nil
+}
+
+// validateSourceUrl checks that rawUrl is an absolute HTTP or HTTPS URL.
+func validateSourceUrl(path *field.Path, rawUrl string) field.ErrorList {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		// The URL may contain credentials, so only the cause is reported.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return field.ErrorList{field.Invalid(path, "", fmt.Sprintf("malformed URL: %v", err))}
+	}
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" {
+		return field.ErrorList{field.Invalid(path, redactParsedURL(parsedUrl), "the URL must use http or https")}
+	}
+	if parsedUrl.Host == "" {
+		return field.ErrorList{field.Invalid(path, redactParsedURL(parsedUrl), "the URL must include a host")}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RedactURL removes the user info and the query, which may hold credentials or a
+// token, from rawURL, so it can be logged or stored in a status. The init container
+// redacts the URLs it reports in the same way.
+func RedactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return redactParsedURL(parsedURL)
+}
+
+func redactParsedURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	redacted.Fragment = ""
+	redacted.RawFragment = ""
+	return redacted.String()
+}
+
+// ConfigMapKeyForPath returns the key of the config map which is projected to path in
+// the config volume, or an empty string if no key is projected to path.
+func ConfigMapKeyForPath(config *corev1.ConfigMapVolumeSource, path string) string {
+	if len(config.Items) == 0 {
+		return path
+	}
+
+	for _, item := range config.Items {
+		if item.Path == path {
+			return item.Key
+		}
+	}
+
+	return ""
+}
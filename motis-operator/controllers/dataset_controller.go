@@ -18,19 +18,27 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/go-logr/logr"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"path"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	configv1alpha1 "github.com/vstollen/motis-operator/api/config/v1alpha1"
 	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
 )
 
@@ -38,11 +46,17 @@ import (
 type DatasetReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Defaults for the fields of Datasets admitted without the defaulting webhook.
+	Defaults configv1alpha1.Defaults
 }
 
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=datasets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=datasets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=datasets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -85,11 +99,33 @@ func (r *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
+	processingPods := &corev1.PodList{}
+	if processingJob.UID != "" {
+		log.Info("Fetching processing pods")
+		if err := r.List(ctx, processingPods, client.InNamespace(req.Namespace), client.MatchingLabels{"controller-uid": string(processingJob.UID)}); err != nil {
+			log.Error(err, "Error listing processing pods")
+			return ctrl.Result{}, err
+		}
+	}
+
 	log.Info("Updating status")
-	if err := r.updateStatus(ctx, req, dataset, inputVolume, dataVolume, processingJob, log); err != nil {
+	if err := r.updateStatus(ctx, req, dataset, inputVolume, dataVolume, processingJob, processingPods, log); err != nil {
 		log.Error(err, "Error updating status")
 	}
 
+	switch dataset.Status.Phase {
+	case motisv1alpha1.DatasetPhaseFailed:
+		// A permanent failure fails again on every retry, so the Job must not start another pod.
+		if err := r.suspendProcessingJob(ctx, processingJob, log); err != nil {
+			log.Error(err, "Error suspending processing job")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	case motisv1alpha1.DatasetPhaseReady:
+		// The volumes and the Job are kept, but never recreated once processing finished.
+		return ctrl.Result{}, nil
+	}
+
 	if inputVolume == nil || inputVolume.UID == "" {
 		log.Info("No input volume claimed. Creating PVC")
 		if err := r.createInputPVC(ctx, dataset, log); err != nil {
@@ -120,7 +156,7 @@ func (r *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return ctrl.Result{}, nil
 }
 
-func (r *DatasetReconciler) updateStatus(ctx context.Context, req ctrl.Request, dataset *motisv1alpha1.Dataset, inputVolume *corev1.PersistentVolumeClaim, dataVolume *corev1.PersistentVolumeClaim, processingJob *batchv1.Job, log logr.Logger) error {
+func (r *DatasetReconciler) updateStatus(ctx context.Context, req ctrl.Request, dataset *motisv1alpha1.Dataset, inputVolume *corev1.PersistentVolumeClaim, dataVolume *corev1.PersistentVolumeClaim, processingJob *batchv1.Job, processingPods *corev1.PodList, log logr.Logger) error {
 	if inputVolume != nil {
 		dataset.Status.InputVolume = &corev1.VolumeSource{
 			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: inputVolume.Name},
@@ -137,27 +173,26 @@ func (r *DatasetReconciler) updateStatus(ctx context.Context, req ctrl.Request,
 		dataset.Status.DataVolume = nil
 	}
 
-	readyCondition := &motisv1alpha1.DatasetCondition{
-		Type:   motisv1alpha1.DatasetReady,
-		Status: corev1.ConditionUnknown,
+	for _, pod := range processingPods.Items {
+		initReport, initTerminated := terminationReportForPod(&pod, "motis-init", log)
+		if initReport != nil && initTerminated.ExitCode == 0 {
+			dataset.Status.Inputs = initReport.Inputs
+			dataset.Status.InputsTruncated = initReport.Truncated
+			dataset.Status.InputsSize = initReport.Bytes
+		}
 	}
 
-	if processingJob != nil {
-		for _, condition := range processingJob.Status.Conditions {
-			if condition.Type == batchv1.JobComplete {
-				switch condition.Status {
-				case corev1.ConditionTrue:
-					readyCondition.Status = corev1.ConditionTrue
-					break
-				case corev1.ConditionFalse:
-					readyCondition.Status = corev1.ConditionFalse
-					break
-				}
-			}
-		}
+	if digest := importDigest(processingPods); digest != "" {
+		dataset.Status.ImageDigest = digest
 	}
 
-	dataset.Status.Conditions = []motisv1alpha1.DatasetCondition{*readyCondition}
+	setDatasetConditions(dataset, inputVolume, dataVolume, processingJob, processingPods, log)
+
+	phase := nextPhase(dataset.Status.Phase, observeDataset(inputVolume, dataVolume, processingJob, processingPods, log))
+	if phase != dataset.Status.Phase {
+		log.Info("Dataset changed phase", "from", dataset.Status.Phase, "to", phase)
+	}
+	setPhase(&dataset.Status, phase, metav1.Now())
 
 	if err := r.Client.Status().Update(ctx, dataset); err != nil {
 		log.Error(err, "Error updating status")
@@ -172,18 +207,18 @@ func (r *DatasetReconciler) updateStatus(ctx context.Context, req ctrl.Request,
 }
 
 func (r *DatasetReconciler) createInputPVC(ctx context.Context, dataset *motisv1alpha1.Dataset, log logr.Logger) error {
+	spec := r.specForDataset(dataset)
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dataset.Name + "-input",
 			Namespace: dataset.Namespace,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-			},
+			AccessModes:      spec.InputVolume.AccessModes,
+			StorageClassName: spec.InputVolume.StorageClassName,
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					"storage": resource.MustParse("10Gi"),
+					"storage": *spec.InputVolume.Size,
 				},
 			},
 		},
@@ -221,7 +256,11 @@ func (r *DatasetReconciler) createDataPVC(ctx context.Context, dataset *motisv1a
 }
 
 func (r *DatasetReconciler) createProcessingJob(ctx context.Context, dataset *motisv1alpha1.Dataset, log logr.Logger) error {
-	job := r.processingJobForDataset(dataset)
+	job, err := r.processingJobForDataset(dataset)
+	if err != nil {
+		log.Error(err, "unable to apply the pod overrides to the processing job")
+		return err
+	}
 
 	if err := ctrl.SetControllerReference(dataset, job, r.Scheme); err != nil {
 		log.Error(err, "unable to set controller reference on processing job")
@@ -236,19 +275,34 @@ func (r *DatasetReconciler) createProcessingJob(ctx context.Context, dataset *mo
 	return nil
 }
 
+// suspendProcessingJob suspends processingJob unless it already finished, so it starts no further pods.
+func (r *DatasetReconciler) suspendProcessingJob(ctx context.Context, processingJob *batchv1.Job, log logr.Logger) error {
+	if processingJob == nil || processingJob.UID == "" || jobCondition(processingJob, batchv1.JobFailed) != nil || jobCondition(processingJob, batchv1.JobComplete) != nil {
+		return nil
+	}
+	if processingJob.Spec.Suspend != nil && *processingJob.Spec.Suspend {
+		return nil
+	}
+
+	log.Info("Suspending processing job after a permanent failure")
+	suspend := true
+	processingJob.Spec.Suspend = &suspend
+	return r.Update(ctx, processingJob)
+}
+
 func (r *DatasetReconciler) dataPvcForDataset(dataset *motisv1alpha1.Dataset) *corev1.PersistentVolumeClaim {
+	spec := r.specForDataset(dataset)
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dataset.Name + "-data",
 			Namespace: dataset.Namespace,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-			},
+			AccessModes:      spec.DataVolume.AccessModes,
+			StorageClassName: spec.DataVolume.StorageClassName,
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					"storage": resource.MustParse("10Gi"),
+					"storage": *spec.DataVolume.Size,
 				},
 			},
 		},
@@ -257,77 +311,391 @@ func (r *DatasetReconciler) dataPvcForDataset(dataset *motisv1alpha1.Dataset) *c
 	return pvc
 }
 
-func (r *DatasetReconciler) processingJobForDataset(dataset *motisv1alpha1.Dataset) *batchv1.Job {
+func (r *DatasetReconciler) processingJobForDataset(dataset *motisv1alpha1.Dataset) (*batchv1.Job, error) {
+	spec := r.specForDataset(dataset)
+	backoffLimit := int32(processingBackoffLimit)
+	initVolumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "config",
+			MountPath: "/config",
+		},
+		{
+			Name:      "input-volume",
+			MountPath: spec.InputVolume.MountPath,
+		},
+		{
+			Name:      "tools",
+			MountPath: "/tools",
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: "data-volume",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataset.Name + "-data"},
+			},
+		},
+		{
+			Name: "input-volume",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataset.Name + "-input"},
+			},
+		},
+		{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: dataset.Spec.Config,
+			},
+		},
+		{
+			// The init container installs its binary here, which wraps the MOTIS import.
+			Name: "tools",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+
+	if dataset.Spec.Credentials != nil {
+		initVolumeMounts = append(initVolumeMounts, corev1.VolumeMount{
+			Name:      "credentials",
+			MountPath: "/credentials",
+			ReadOnly:  true,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: dataset.Spec.Credentials,
+			},
+		})
+	}
+
 	processJob := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dataset.Name,
 			Namespace: dataset.Namespace,
 		},
 		Spec: batchv1.JobSpec{
+			// The init container retries failed downloads itself, and most other failures are permanent.
+			BackoffLimit: &backoffLimit,
 			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					// The operator only caches pods with this label.
+					Labels: map[string]string{datasetLabel: dataset.Name},
+				},
 				Spec: corev1.PodSpec{
 					InitContainers: []corev1.Container{
 						{
-							Name:  "motis-init",
-							Image: "ghcr.io/vstollen/motis-init:0.1.1",
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "config",
-									MountPath: "/config",
-								},
-								{
-									Name:      "input-volume",
-									MountPath: "/input",
-								},
-							},
+							Name:                     "motis-init",
+							Image:                    spec.InitImage,
+							ImagePullPolicy:          spec.ImagePullPolicy,
+							Resources:                spec.InitResources,
+							Args:                     []string{"--input-dir", spec.InputVolume.MountPath},
+							VolumeMounts:             initVolumeMounts,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 						},
 					},
 					Containers: []corev1.Container{
 						{
-							Name:    "motis",
-							Image:   "ghcr.io/motis-project/motis:latest",
-							Command: []string{"/motis/motis", "--system_config", "/system_config.ini", "-c", "/config/config.ini", "--mode", "test"},
+							Name:                     "motis",
+							Image:                    spec.Image,
+							ImagePullPolicy:          spec.ImagePullPolicy,
+							Resources:                spec.ImportResources,
+							Command:                  []string{"/tools/motis-init", "wrap", "--", "/motis/motis", "--system_config", "/system_config.ini", "-c", path.Join(spec.InputVolume.MountPath, importConfigFile), "--mode", "test"},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 							VolumeMounts: []corev1.VolumeMount{{
 								Name:      "data-volume",
-								MountPath: "/data",
+								MountPath: spec.DataVolume.MountPath,
 							},
 								{
 									Name:      "input-volume",
-									MountPath: "/input",
+									MountPath: spec.InputVolume.MountPath,
 								},
 								{
 									Name:      "config",
 									MountPath: "/config",
 								},
+								{
+									Name:      "tools",
+									MountPath: "/tools",
+								},
 							},
 						},
 					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "data-volume",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataset.Name + "-data"},
-							},
-						},
-						{
-							Name: "input-volume",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataset.Name + "-input"},
-							},
-						},
-						{
-							Name: "config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: dataset.Spec.Config,
-							},
-						},
-					},
-					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes:          volumes,
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: spec.ImagePullSecrets,
 				},
 			},
 		},
 	}
-	return processJob
+
+	if err := applyPodOverrides(&processJob.Spec.Template, spec.PodOverrides); err != nil {
+		return nil, err
+	}
+	return processJob, nil
+}
+
+// specForDataset returns the spec of dataset with the fields left unset filled in from the defaults.
+func (r *DatasetReconciler) specForDataset(dataset *motisv1alpha1.Dataset) *motisv1alpha1.DatasetSpec {
+	spec := dataset.Spec.DeepCopy()
+	spec.SetDefaults(r.Defaults)
+	return spec
+}
+
+// How often the processing Job retries a failed pod.
+const processingBackoffLimit = 1
+
+// The categories of init container failures which fail the same way when the Job retries them.
+var permanentInitFailures = map[string]bool{
+	"InvalidConfig":      true,
+	"VerificationFailed": true,
+	"ExtractionFailed":   true,
+	"ValidationFailed":   true,
+}
+
+// setDatasetConditions derives the Ready, Progressing and Failed conditions of
+// dataset from its volumes, its processing Job and the containers of the Job's pods.
+// Once the Dataset is ready or failed, its conditions are final, as the Job and its
+// pods may be deleted afterwards.
+func setDatasetConditions(dataset *motisv1alpha1.Dataset, inputVolume *corev1.PersistentVolumeClaim, dataVolume *corev1.PersistentVolumeClaim, processingJob *batchv1.Job, processingPods *corev1.PodList, log logr.Logger) {
+	migrateLegacyConditions(dataset)
+	if dataset.HasFinishedProcessing() || dataset.HasFailed() {
+		return
+	}
+
+	ready := metav1.Condition{Type: motisv1alpha1.DatasetReady, Status: metav1.ConditionFalse, ObservedGeneration: dataset.Generation}
+	progressing := metav1.Condition{Type: motisv1alpha1.DatasetProgressing, Status: metav1.ConditionTrue, ObservedGeneration: dataset.Generation}
+	failed := metav1.Condition{Type: motisv1alpha1.DatasetFailed, Status: metav1.ConditionFalse, Reason: "AsExpected", ObservedGeneration: dataset.Generation}
+
+	failure := latestPodFailure(processingPods, log)
+	jobComplete := jobCondition(processingJob, batchv1.JobComplete)
+	jobFailed := jobCondition(processingJob, batchv1.JobFailed)
+
+	switch {
+	case jobComplete != nil:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionTrue, "Imported", "The import finished successfully"
+		progressing.Status, progressing.Reason = metav1.ConditionFalse, "Completed"
+	case jobFailed != nil || (failure != nil && failure.permanent):
+		reason, message := "JobFailed", ""
+		if jobFailed != nil {
+			reason, message = jobFailed.Reason, jobFailed.Message
+		}
+		if failure != nil {
+			reason, message = failure.reason, failure.message
+		}
+		ready.Reason, ready.Message = reason, message
+		progressing.Status, progressing.Reason, progressing.Message = metav1.ConditionFalse, reason, message
+		failed.Status, failed.Reason, failed.Message = metav1.ConditionTrue, reason, message
+	case !isBound(inputVolume) || !isBound(dataVolume):
+		ready.Reason, ready.Message = "Provisioning", "Waiting for the volumes to be bound"
+		progressing.Reason, progressing.Message = "Provisioning", ready.Message
+	case processingJob == nil || processingJob.UID == "":
+		ready.Reason, ready.Message = "Provisioning", "Waiting for the processing Job to be created"
+		progressing.Reason, progressing.Message = "Provisioning", ready.Message
+	case failure != nil:
+		ready.Reason, ready.Message = "Retrying", failure.message
+		progressing.Reason, progressing.Message = "Retrying", failure.message
+	default:
+		reason, message := "Pending", "Waiting for the processing pod to start"
+		for _, pod := range processingPods.Items {
+			if running(pod.Status.InitContainerStatuses, "motis-init") {
+				reason, message = "Downloading", "The init container downloads the schedules and map data"
+			} else if running(pod.Status.ContainerStatuses, "motis") {
+				reason, message = "Importing", "MOTIS imports the downloaded data"
+			}
+		}
+		ready.Reason, ready.Message = reason, message
+		progressing.Reason, progressing.Message = reason, message
+	}
+
+	meta.SetStatusCondition(&dataset.Status.Conditions, ready)
+	meta.SetStatusCondition(&dataset.Status.Conditions, progressing)
+	meta.SetStatusCondition(&dataset.Status.Conditions, failed)
+}
+
+// migrateLegacyConditions fills in the reason and the last transition time of the
+// conditions written by earlier operator versions. The Dataset CRD requires both, so
+// every status update of the Dataset would be rejected otherwise.
+func migrateLegacyConditions(dataset *motisv1alpha1.Dataset) {
+	for i := range dataset.Status.Conditions {
+		condition := &dataset.Status.Conditions[i]
+		if condition.Reason == "" {
+			condition.Reason = "Unknown"
+			if condition.Type == motisv1alpha1.DatasetReady && condition.Status == metav1.ConditionTrue {
+				condition.Reason = "Imported"
+			}
+		}
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = dataset.CreationTimestamp
+			if condition.LastTransitionTime.IsZero() {
+				condition.LastTransitionTime = metav1.Now()
+			}
+		}
+	}
+}
+
+// podFailure describes a failed container of a processing pod.
+type podFailure struct {
+	reason  string
+	message string
+	// permanent is set if retrying the pod will fail the same way.
+	permanent bool
+}
+
+// latestPodFailure returns the failure of the most recently created processing
+// pod with a failed container, or nil if no container failed.
+func latestPodFailure(processingPods *corev1.PodList, log logr.Logger) *podFailure {
+	var latest *podFailure
+	var latestCreation metav1.Time
+
+	for _, pod := range processingPods.Items {
+		if latest != nil && pod.CreationTimestamp.Before(&latestCreation) {
+			continue
+		}
+
+		// A failed init container prevents the import, so its failure takes precedence.
+		for _, container := range []string{"motis-init", "motis"} {
+			report, terminated := terminationReportForPod(&pod, container, log)
+			if report == nil || terminated.ExitCode == 0 {
+				continue
+			}
+
+			latest = &podFailure{
+				reason:    report.reason(container, terminated),
+				message:   report.message(container, terminated),
+				permanent: container == "motis-init" && permanentInitFailures[report.Category],
+			}
+			latestCreation = pod.CreationTimestamp
+			break
+		}
+	}
+
+	return latest
+}
+
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	if job == nil {
+		return nil
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			c := condition
+			return &c
+		}
+	}
+	return nil
+}
+
+func isBound(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc != nil && pvc.UID != "" && pvc.Status.Phase == corev1.ClaimBound
+}
+
+func running(statuses []corev1.ContainerStatus, container string) bool {
+	for _, status := range statuses {
+		if status.Name == container && status.State.Running != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// terminationReport is the termination message written by the motis-init
+// container, or by its wrapper around the MOTIS import.
+type terminationReport struct {
+	Inputs     []motisv1alpha1.DatasetInput `json:"inputs"`
+	Validation []feedValidationSummary      `json:"validation,omitempty"`
+	Sources    int                          `json:"sources"`
+	Bytes      int64                        `json:"bytes"`
+	Failures   []string                     `json:"failures,omitempty"`
+	Category   string                       `json:"category,omitempty"`
+	Error      string                       `json:"error,omitempty"`
+	ExitCode   int                          `json:"exitCode,omitempty"`
+	Output     []string                     `json:"output,omitempty"`
+	Truncated  bool                         `json:"truncated,omitempty"`
+
+	// raw holds the termination message if it is not a report, e.g. the end of the
+	// container log if the container failed before writing its report.
+	raw string
+}
+
+// feedValidationSummary is the validation result of a single schedule.
+type feedValidationSummary struct {
+	Name       string `json:"name"`
+	Errors     int    `json:"errors"`
+	Warnings   int    `json:"warnings"`
+	FirstError string `json:"firstError,omitempty"`
+}
+
+// validationMessage summarizes the schedules which failed validation.
+func (r *terminationReport) validationMessage() string {
+	var messages []string
+	for _, feed := range r.Validation {
+		if feed.Errors > 0 {
+			messages = append(messages, fmt.Sprintf("schedule %v has %d error(s), first: %v", feed.Name, feed.Errors, feed.FirstError))
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// reason returns the reason of the Failed condition if container failed with this report.
+func (r *terminationReport) reason(container string, terminated *corev1.ContainerStateTerminated) string {
+	if r.Category != "" {
+		return r.Category
+	}
+	if terminated.Reason != "" && terminated.Reason != "Error" {
+		// E.g. OOMKilled or DeadlineExceeded.
+		return terminated.Reason
+	}
+	if container == "motis-init" {
+		return "InitFailed"
+	}
+	return "ImportFailed"
+}
+
+// message returns the message of the Failed condition if container failed with this report.
+func (r *terminationReport) message(container string, terminated *corev1.ContainerStateTerminated) string {
+	if message := r.validationMessage(); message != "" {
+		return message
+	}
+
+	message := fmt.Sprintf("container %v exited with code %d", container, terminated.ExitCode)
+	switch {
+	case r.Error != "":
+		message += ": " + r.Error
+	case r.raw != "":
+		message += ": " + r.raw
+	}
+	if len(r.Output) > 0 {
+		message += "\n" + strings.Join(r.Output, "\n")
+	}
+	return message
+}
+
+// terminationReportForPod returns the report and terminated state of the named
+// container of the pod, or a nil report if the container has not terminated yet.
+func terminationReportForPod(pod *corev1.Pod, container string, log logr.Logger) (*terminationReport, *corev1.ContainerStateTerminated) {
+	var statuses []corev1.ContainerStatus
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name != container || status.State.Terminated == nil {
+			continue
+		}
+
+		terminated := status.State.Terminated
+		report := &terminationReport{}
+		if terminated.Message == "" {
+			return report, terminated
+		}
+		if err := json.Unmarshal([]byte(terminated.Message), report); err != nil {
+			log.Info("Termination message is not a report", "Pod.Name", pod.Name, "Container", container)
+			report = &terminationReport{raw: strings.TrimSpace(terminated.Message)}
+		}
+		return report, terminated
+	}
+
+	return nil, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -336,5 +704,17 @@ func (r *DatasetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&motisv1alpha1.Dataset{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&batchv1.Job{}).
+		// Pods are owned by the Job, so their changes are mapped to the Dataset of the Job.
+		// Only pods labelled with their Dataset are cached, see CacheOptions.
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(datasetForProcessingPod)).
 		Complete(r)
 }
+
+// datasetForProcessingPod maps a processing pod to the Dataset its Job is named after.
+func datasetForProcessingPod(pod client.Object) []reconcile.Request {
+	jobName, ok := pod.GetLabels()["job-name"]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: jobName, Namespace: pod.GetNamespace()}}}
+}
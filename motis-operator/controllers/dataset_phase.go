@@ -0,0 +1,94 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// datasetObservation is what the DatasetReconciler observed about the resources of a Dataset.
+type datasetObservation struct {
+	// volumesCreated is set once both PVCs exist.
+	volumesCreated bool
+	// downloading is set while the init container of a processing pod runs.
+	downloading bool
+	// importing is set while the MOTIS container of a processing pod runs.
+	importing bool
+	complete  bool
+	// failed is set if the Job failed or a pod failed in a way a retry will not fix.
+	failed bool
+}
+
+// observeDataset collects the observation of a Dataset from its resources.
+func observeDataset(inputVolume *corev1.PersistentVolumeClaim, dataVolume *corev1.PersistentVolumeClaim, processingJob *batchv1.Job, processingPods *corev1.PodList, log logr.Logger) datasetObservation {
+	failure := latestPodFailure(processingPods, log)
+	o := datasetObservation{
+		volumesCreated: inputVolume != nil && inputVolume.UID != "" && dataVolume != nil && dataVolume.UID != "",
+		complete:       jobCondition(processingJob, batchv1.JobComplete) != nil,
+		failed:         jobCondition(processingJob, batchv1.JobFailed) != nil || (failure != nil && failure.permanent),
+	}
+
+	for _, pod := range processingPods.Items {
+		o.downloading = o.downloading || running(pod.Status.InitContainerStatuses, "motis-init")
+		o.importing = o.importing || running(pod.Status.ContainerStatuses, "motis")
+	}
+
+	return o
+}
+
+// nextPhase returns the phase a Dataset in phase current moves to, given what was observed.
+// Ready and Failed are final. While the Job retries a failed pod, a Dataset may move from
+// Importing back to Downloading.
+func nextPhase(current motisv1alpha1.DatasetPhase, o datasetObservation) motisv1alpha1.DatasetPhase {
+	switch {
+	case current == motisv1alpha1.DatasetPhaseReady || current == motisv1alpha1.DatasetPhaseFailed:
+		return current
+	case o.failed:
+		return motisv1alpha1.DatasetPhaseFailed
+	case o.complete:
+		return motisv1alpha1.DatasetPhaseReady
+	case o.importing:
+		return motisv1alpha1.DatasetImporting
+	case o.downloading:
+		return motisv1alpha1.DatasetDownloading
+	case current == motisv1alpha1.DatasetDownloading || current == motisv1alpha1.DatasetImporting:
+		// Between two containers, or while the Job starts a new pod.
+		return current
+	case o.volumesCreated:
+		return motisv1alpha1.DatasetProvisioning
+	default:
+		return motisv1alpha1.DatasetPending
+	}
+}
+
+// setPhase moves status to phase, recording the start of the phase if it changed.
+func setPhase(status *motisv1alpha1.DatasetStatus, phase motisv1alpha1.DatasetPhase, now metav1.Time) {
+	if status.Phase == phase {
+		return
+	}
+
+	status.Phase = phase
+	status.PhaseHistory = append(status.PhaseHistory, motisv1alpha1.DatasetPhaseTransition{
+		Phase:     phase,
+		StartTime: now,
+	})
+}
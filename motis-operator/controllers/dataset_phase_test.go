@@ -0,0 +1,104 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestNextPhase(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  motisv1alpha1.DatasetPhase
+		observed datasetObservation
+		want     motisv1alpha1.DatasetPhase
+	}{
+		{"new dataset", "", datasetObservation{}, motisv1alpha1.DatasetPending},
+		{"volumes created", motisv1alpha1.DatasetPending, datasetObservation{volumesCreated: true}, motisv1alpha1.DatasetProvisioning},
+		{"init container running", motisv1alpha1.DatasetProvisioning, datasetObservation{volumesCreated: true, downloading: true}, motisv1alpha1.DatasetDownloading},
+		{"import running", motisv1alpha1.DatasetDownloading, datasetObservation{volumesCreated: true, importing: true}, motisv1alpha1.DatasetImporting},
+		{"between containers", motisv1alpha1.DatasetDownloading, datasetObservation{volumesCreated: true}, motisv1alpha1.DatasetDownloading},
+		{"retry after failed import", motisv1alpha1.DatasetImporting, datasetObservation{volumesCreated: true, downloading: true}, motisv1alpha1.DatasetDownloading},
+		{"job complete", motisv1alpha1.DatasetImporting, datasetObservation{volumesCreated: true, complete: true}, motisv1alpha1.DatasetPhaseReady},
+		{"job failed", motisv1alpha1.DatasetImporting, datasetObservation{volumesCreated: true, failed: true}, motisv1alpha1.DatasetPhaseFailed},
+		{"ready is final", motisv1alpha1.DatasetPhaseReady, datasetObservation{}, motisv1alpha1.DatasetPhaseReady},
+		{"failed is final", motisv1alpha1.DatasetPhaseFailed, datasetObservation{complete: true}, motisv1alpha1.DatasetPhaseFailed},
+	}
+
+	for _, test := range tests {
+		if got := nextPhase(test.current, test.observed); got != test.want {
+			t.Errorf("%v: nextPhase(%q) = %q, want %q", test.name, test.current, got, test.want)
+		}
+	}
+}
+
+func TestSetDatasetConditionsKeepsFinalConditions(t *testing.T) {
+	for _, condition := range []string{motisv1alpha1.DatasetReady, motisv1alpha1.DatasetFailed} {
+		dataset := &motisv1alpha1.Dataset{
+			Status: motisv1alpha1.DatasetStatus{
+				Conditions: []metav1.Condition{{Type: condition, Status: metav1.ConditionTrue, Reason: "Final"}},
+			},
+		}
+
+		// The volumes and the Job were deleted.
+		setDatasetConditions(dataset, nil, nil, nil, &corev1.PodList{}, logr.Discard())
+
+		if !meta.IsStatusConditionTrue(dataset.Status.Conditions, condition) || len(dataset.Status.Conditions) != 1 {
+			t.Errorf("setDatasetConditions() changed the final %v condition: %v", condition, dataset.Status.Conditions)
+		}
+	}
+}
+
+func TestSetDatasetConditionsMigratesLegacyConditions(t *testing.T) {
+	created := metav1.NewTime(time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name       string
+		legacy     metav1.Condition
+		wantReady  metav1.ConditionStatus
+		wantReason string
+	}{
+		{"ready", metav1.Condition{Type: motisv1alpha1.DatasetReady, Status: metav1.ConditionTrue}, metav1.ConditionTrue, "Imported"},
+		{"processing", metav1.Condition{Type: motisv1alpha1.DatasetReady, Status: metav1.ConditionUnknown}, metav1.ConditionFalse, "Provisioning"},
+	}
+
+	for _, test := range tests {
+		dataset := &motisv1alpha1.Dataset{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: created},
+			Status:     motisv1alpha1.DatasetStatus{Conditions: []metav1.Condition{test.legacy}},
+		}
+
+		setDatasetConditions(dataset, nil, nil, nil, &corev1.PodList{}, logr.Discard())
+
+		ready := meta.FindStatusCondition(dataset.Status.Conditions, motisv1alpha1.DatasetReady)
+		if ready == nil || ready.Status != test.wantReady || ready.Reason != test.wantReason {
+			t.Errorf("%v: setDatasetConditions() set Ready to %v, want status %v with reason %v", test.name, ready, test.wantReady, test.wantReason)
+		}
+		for _, condition := range dataset.Status.Conditions {
+			if condition.Reason == "" || condition.LastTransitionTime.IsZero() {
+				t.Errorf("%v: setDatasetConditions() left condition %v without reason or last transition time", test.name, condition)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// The file in the config volume holding the MOTIS config.
+const motisConfigFile = "config.ini"
+
+// The config file the init container writes to the input volume, with the import paths added.
+const importConfigFile = "config.ini"
+
+// configMapName returns the name of the config map rendered for motis.
+func configMapName(motis *motisv1alpha1.Motis) string {
+	return motis.Name + "-config"
+}
+
+// configForMotis returns the config volume of motis. It is the rendered config
+// map if motis uses the typed config, otherwise the config map given in the spec.
+func configForMotis(motis *motisv1alpha1.Motis) *corev1.ConfigMapVolumeSource {
+	if !motis.HasTypedConfig() {
+		return motis.Spec.Config
+	}
+
+	return &corev1.ConfigMapVolumeSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: configMapName(motis)},
+	}
+}
+
+// reconcileConfigMap creates or updates the config map rendered from the typed config of motis.
+func (r *MotisReconciler) reconcileConfigMap(ctx context.Context, motis *motisv1alpha1.Motis, log logr.Logger) error {
+	if !motis.HasTypedConfig() {
+		return nil
+	}
+
+	desired := configMapForMotis(motis, r.specForMotis(motis).DataVolume.MountPath)
+	if err := ctrl.SetControllerReference(motis, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	current := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if errors.IsNotFound(err) {
+		log.Info("Creating config map", "ConfigMap.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+
+	if reflect.DeepEqual(current.Data, desired.Data) {
+		return nil
+	}
+
+	log.Info("Updating config map", "ConfigMap.Name", desired.Name)
+	current.Data = desired.Data
+	return r.Update(ctx, current)
+}
+
+// configMapForMotis returns the config map rendered from the typed config of motis.
+// MOTIS stores the imported data in dataDir, unless the raw config sets another directory.
+func configMapForMotis(motis *motisv1alpha1.Motis, dataDir string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(motis),
+			Namespace: motis.Namespace,
+		},
+		Data: map[string]string{
+			motisConfigFile:     renderMotisConfig(motis.Spec.Modules, motis.Spec.RawConfig, dataDir),
+			schedulesConfigFile: renderSources(motis.Spec.Schedules),
+			osmConfigFile:       renderSources(motis.Spec.OSM),
+		},
+	}
+}
+
+// renderSources renders sources in the format read by the init container:
+//
+//	https://example.com/gtfs.zip sha256=9f86d081884c7d65... size=1048576
+func renderSources(sources []motisv1alpha1.Source) string {
+	var b strings.Builder
+	for _, source := range sources {
+		b.WriteString(source.URL)
+		if source.SHA256 != "" {
+			fmt.Fprintf(&b, " sha256=%v", strings.ToLower(source.SHA256))
+		}
+		if source.Size != nil {
+			fmt.Fprintf(&b, " size=%d", *source.Size)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderMotisConfig renders config.ini from the enabled modules and the raw config.
+// Sections of the raw config are merged with the sections of the modules, so
+// every section appears only once. The import paths are added by the init container.
+func renderMotisConfig(modules []motisv1alpha1.ModuleSpec, rawConfig string, dataDir string) string {
+	config := &iniFile{sections: map[string][]string{}}
+
+	for _, module := range modules {
+		config.add("", "modules="+module.Name)
+	}
+
+	section := ""
+	for _, line := range strings.Split(rawConfig, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			config.add(section, "")
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		config.add(section, trimmed)
+	}
+
+	for _, module := range modules {
+		for _, setting := range module.Settings {
+			config.add(module.Name, setting.Key+"="+setting.Value)
+		}
+	}
+
+	if !config.hasKey("import", "data_dir") {
+		config.add("import", "data_dir="+dataDir)
+	}
+
+	return config.String()
+}
+
+// iniFile collects the lines of a config file by section. The section "" holds
+// the options before the first section.
+type iniFile struct {
+	order    []string
+	sections map[string][]string
+}
+
+// add appends line to section. Duplicate lines are dropped.
+func (f *iniFile) add(section string, line string) {
+	lines, ok := f.sections[section]
+	if !ok && section != "" {
+		f.order = append(f.order, section)
+	}
+	if line == "" {
+		f.sections[section] = lines
+		return
+	}
+
+	for _, existing := range lines {
+		if existing == line {
+			return
+		}
+	}
+	f.sections[section] = append(lines, line)
+}
+
+func (f *iniFile) hasKey(section string, key string) bool {
+	for _, line := range f.sections[section] {
+		if name, _, _ := strings.Cut(line, "="); strings.TrimSpace(name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *iniFile) String() string {
+	var b strings.Builder
+	for _, line := range f.sections[""] {
+		b.WriteString(line + "\n")
+	}
+	for _, section := range f.order {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("[" + section + "]\n")
+		for _, line := range f.sections[section] {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
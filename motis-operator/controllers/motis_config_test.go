@@ -0,0 +1,69 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestRenderMotisConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modules   []motisv1alpha1.ModuleSpec
+		rawConfig string
+		want      string
+	}{
+		{
+			"module settings",
+			[]motisv1alpha1.ModuleSpec{
+				{Name: "routing"},
+				{Name: "ppr", Settings: []motisv1alpha1.ModuleSetting{{Key: "profile", Value: "/motis/ppr-profiles/default.json"}}},
+				{Name: "osrm", Settings: []motisv1alpha1.ModuleSetting{{Key: "profiles", Value: "car.lua"}, {Key: "profiles", Value: "bike.lua"}}},
+			},
+			"",
+			"modules=routing\nmodules=ppr\nmodules=osrm\n\n[ppr]\nprofile=/motis/ppr-profiles/default.json\n\n[osrm]\nprofiles=car.lua\nprofiles=bike.lua\n\n[import]\ndata_dir=/data\n",
+		},
+		{
+			"raw config merged into the module sections",
+			[]motisv1alpha1.ModuleSpec{
+				{Name: "ppr", Settings: []motisv1alpha1.ModuleSetting{{Key: "profile", Value: "default.json"}, {Key: "max_walk", Value: "600"}}},
+			},
+			"intermodal.router=tripbased\n# comment\n\n[ppr]\n  profile=default.json\n[tiles]\nprofile=background.lua\n[ppr]\nmax_walk=600\n",
+			"modules=ppr\nintermodal.router=tripbased\n\n[ppr]\nprofile=default.json\nmax_walk=600\n\n[tiles]\nprofile=background.lua\n\n[import]\ndata_dir=/data\n",
+		},
+		{
+			"data directory of the raw config",
+			nil,
+			"[import]\ndata_dir = /custom\n",
+			"[import]\ndata_dir = /custom\n",
+		},
+		{
+			"data directory added to the import section",
+			nil,
+			"[import]\nparallel=false\n",
+			"[import]\nparallel=false\ndata_dir=/data\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := renderMotisConfig(test.modules, test.rawConfig, "/data"); got != test.want {
+			t.Errorf("%v: renderMotisConfig() =\n%v\nwant\n%v", test.name, got, test.want)
+		}
+	}
+}
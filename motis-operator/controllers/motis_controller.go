@@ -22,14 +22,18 @@ import (
 	"github.com/robfig/cron/v3"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"path"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"strconv"
 	"time"
 
+	configv1alpha1 "github.com/vstollen/motis-operator/api/config/v1alpha1"
 	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
 )
 
@@ -37,11 +41,24 @@ import (
 type MotisReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Defaults for the fields of Motis resources admitted without the defaulting webhook.
+	Defaults configv1alpha1.Defaults
+
+	// APIReader reads objects which must not be cached, like the credentials secrets.
+	// Reading them through the cached client would cache every secret in the cluster.
+	APIReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=motis,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=motis/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=motis.motis-project.de,resources=motis/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -61,6 +78,25 @@ func (r *MotisReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, err
 	}
 
+	if _, ok := motis.Annotations[motisv1alpha1.RollbackAnnotation]; ok {
+		if err := r.rollback(ctx, motis, log); err != nil {
+			log.Error(err, "Failed to roll back")
+			return ctrl.Result{}, err
+		}
+		// Updating motis triggers another reconciliation.
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.reconcileConfigMap(ctx, motis, log); err != nil {
+		log.Error(err, "Failed to reconcile config map")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileIngress(ctx, motis, log); err != nil {
+		log.Error(err, "Failed to reconcile ingress")
+		return ctrl.Result{}, err
+	}
+
 	datasetsInNamespace := &motisv1alpha1.DatasetList{}
 	if err := r.List(ctx, datasetsInNamespace, client.InNamespace(req.Namespace)); err != nil {
 		log.Error(err, "Failed to list Datasets")
@@ -75,144 +111,306 @@ func (r *MotisReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 
 	if len(childDatasets) == 0 {
-		if err := r.createDataset(ctx, motis, log); err != nil {
+		sources, _ := r.checkSources(ctx, motis, nil, log)
+		dataset, err := r.createDataset(ctx, motis, log)
+		if err != nil {
 			log.Error(err, "Failed to create new Dataset")
 			return ctrl.Result{}, err
 		}
+
+		motis.Status.Sources = sources
+		motis.Status.LastHandledRebuildToken = motis.Annotations[motisv1alpha1.RebuildRequestedAnnotation]
+		if err := r.updateStatus(ctx, motis, dataset, nil, nil, nil, nil); err != nil {
+			log.Error(err, "Failed to update Motis status")
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
 	log.Info("Dataset count", "datasets in namespace", len(datasetsInNamespace.Items), "childDatasets", len(childDatasets))
 
 	latestDataset := findLatestDataset(&childDatasets)
+
+	// The latest Dataset may be missing from the cache right after its creation, so the
+	// images a Dataset was created for are recorded in the status as well.
+	if spec := r.specForMotis(motis); imagesChanged(latestDataset, spec) && motis.Status.LastImageRebuild != imagesOf(spec) {
+		log.Info("The images changed since the latest Dataset. Creating a new Dataset.")
+		dataset, err := r.createDataset(ctx, motis, log)
+		if err != nil {
+			log.Error(err, "Failed to create new Dataset")
+			return ctrl.Result{}, err
+		}
+		latestDataset = dataset
+
+		motis.Status.LastImageRebuild = imagesOf(spec)
+		if err := r.Status().Update(ctx, motis); err != nil {
+			log.Error(err, "Failed to update Motis status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if token := motis.Annotations[motisv1alpha1.RebuildRequestedAnnotation]; token != "" && token != motis.Status.LastHandledRebuildToken {
+		// A Dataset created for the token before its status update failed already handles it.
+		if latestDataset.Annotations[motisv1alpha1.RebuildTokenAnnotation] != token && !rebuildHandled(&childDatasets, token) {
+			log.Info("Rebuild requested. Creating a new Dataset.", "token", token)
+			sources, _ := r.checkSources(ctx, motis, nil, log)
+			dataset, err := r.createDataset(ctx, motis, log)
+			if err != nil {
+				log.Error(err, "Failed to create new Dataset")
+				return ctrl.Result{}, err
+			}
+			motis.Status.Sources = sources
+			latestDataset = dataset
+		}
+
+		motis.Status.LastHandledRebuildToken = token
+		if err := r.Status().Update(ctx, motis); err != nil {
+			log.Error(err, "Failed to update Motis status")
+			return ctrl.Result{}, err
+		}
+	}
+
 	scheduledResult := ctrl.Result{}
+	var nextUpdate *time.Time
 
+	var schedule cron.Schedule
 	if motis.Spec.UpdateSchedule != "" {
-		schedule, err := cron.ParseStandard(motis.Spec.UpdateSchedule)
-		if err != nil {
+		// The webhook rejects invalid schedules, but it may not be deployed.
+		var err error
+		if schedule, err = cron.ParseStandard(motis.Spec.UpdateSchedule); err != nil {
 			log.Error(err, "Error parsing update schedule. Ignoring update schedule")
+			schedule = nil
 		}
+	}
 
-		nextRun := schedule.Next(latestDataset.CreationTimestamp.Time)
+	if schedule != nil {
+		lastUpdate := latestDataset.CreationTimestamp.Time
+		if motis.Status.LastUpdateCheck != nil && motis.Status.LastUpdateCheck.After(lastUpdate) {
+			lastUpdate = motis.Status.LastUpdateCheck.Time
+		}
+
+		nextRun := schedule.Next(lastUpdate)
 		if nextRun.Before(time.Now()) {
-			log.Info("New update scheduled for now. Creating a new Dataset.", "nextRun", nextRun.String(), "latestDatasetCreation", latestDataset.CreationTimestamp.String())
-			if err := r.createDataset(ctx, motis, log); err != nil {
-				log.Error(err, "Failed to create new Dataset")
+			log.Info("New update scheduled for now. Checking sources for changes.", "nextRun", nextRun.String(), "latestDatasetCreation", latestDataset.CreationTimestamp.String())
+			now := metav1.Now()
+
+			if sources, changed := r.checkSources(ctx, motis, latestDataset, log); changed {
+				log.Info("Sources changed. Creating a new Dataset.")
+				dataset, err := r.createDataset(ctx, motis, log)
+				if err != nil {
+					// The check is not recorded, so the update is retried with the requeued request.
+					log.Error(err, "Failed to create new Dataset")
+					return ctrl.Result{}, err
+				}
+				motis.Status.Sources = sources
+				latestDataset = dataset
+			} else {
+				log.Info("No source changed since the latest Dataset. Skipping update.")
+				motis.Status.LastSkippedUpdate = &now
+			}
+			motis.Status.LastUpdateCheck = &now
+
+			if err := r.Status().Update(ctx, motis); err != nil {
+				log.Error(err, "Failed to update Motis status")
+				return ctrl.Result{}, err
 			}
 		}
 
-		scheduledResult.RequeueAfter = schedule.Next(time.Now()).Sub(time.Now())
+		next := schedule.Next(time.Now())
+		nextUpdate = &next
+		scheduledResult.RequeueAfter = next.Sub(time.Now())
 	}
 
 	latestFinishedDataset := findLatestFinishedDataset(&childDatasets)
+	nextDataset := datasetToServe(motis, &childDatasets, latestFinishedDataset, log)
+	motis.Status.Pinned = motis.Spec.PinnedDataset != ""
+
+	deployments, err := r.ownedDeployments(ctx, motis)
+	if err != nil {
+		log.Error(err, "Failed to list Motis deployments")
+		return scheduledResult, err
+	}
 
-	deployment := &appsv1.Deployment{}
-	if err := r.Get(ctx, req.NamespacedName, deployment); client.IgnoreNotFound(err) != nil {
-		log.Error(err, "Failed to get Motis deployment")
+	// Datasets are only deleted once no Deployment serves them anymore. The Datasets
+	// before the served ones are kept as well, so a rollback can return to them.
+	protected := map[string]bool{
+		motis.Status.CurrentDataset:  true,
+		motis.Status.PreviousDataset: true,
+		latestDataset.Name:           true,
+		motis.Spec.PinnedDataset:     true,
+	}
+	for _, served := range []*motisv1alpha1.Dataset{findDataset(&childDatasets, motis.Status.CurrentDataset), nextDataset} {
+		if served == nil {
+			continue
+		}
+		protected[served.Name] = true
+		if previous := findPreviousFinishedDataset(&childDatasets, served); previous != nil {
+			protected[previous.Name] = true
+		}
+	}
+	for name := range deployments {
+		protected[name] = true
+	}
+	retryAfter, err := r.removeOldDatasets(ctx, motis, childDatasets, protected, log)
+	if err != nil {
+		log.Error(err, "Failed to remove old Datasets")
 		return scheduledResult, err
 	}
+	requeueAfter(&scheduledResult, retryAfter)
 
-	if latestFinishedDataset != nil && (deployment == nil || deployment.UID == "") {
-		log.Info("Dataset has finished processing but there currently is no deployment. Starting new deployment.")
-		if err := r.createDeployment(ctx, motis, latestFinishedDataset, log); err != nil {
-			log.Error(err, "Error creating Motis deployment")
+	if nextDataset == nil {
+		log.Info("No Dataset has finished processing yet")
+		if err := r.reconcileService(ctx, motis, map[string]string{motisDeploymentLabel: motis.Name}, log); err != nil {
+			log.Error(err, "Failed to reconcile service")
+			return scheduledResult, err
+		}
+		if err := r.updateStatus(ctx, motis, latestDataset, nil, nil, nil, nextUpdate); err != nil {
+			log.Error(err, "Failed to update Motis status")
 			return scheduledResult, err
 		}
 		return scheduledResult, nil
 	}
 
-	deployment.Spec.Template.Spec.Volumes = volumesForMotisDeployment(motis, latestFinishedDataset)
-	if err := r.Update(ctx, deployment); err != nil {
-		log.Error(err, "Error updating Motis deployment")
+	// Every Dataset is served by its own Deployment. The Service keeps routing to the
+	// Deployment of the current Dataset until the Deployment of the next Dataset is
+	// available, so switching Datasets causes no downtime.
+	nextDeployment, err := r.reconcileDeployment(ctx, motis, nextDataset, deployments[nextDataset.Name], log)
+	if err != nil {
+		log.Error(err, "Error reconciling Motis deployment")
 		return scheduledResult, err
 	}
 
-	return scheduledResult, nil
-}
+	currentDataset := findDataset(&childDatasets, motis.Status.CurrentDataset)
+	currentDeployment := deployments[motis.Status.CurrentDataset]
+	if currentDeployment == nil {
+		// The single Deployment of operator versions before blue/green switchovers.
+		currentDeployment = deployments[motis.Name]
+	}
+	if currentDataset == nil || currentDeployment == nil || deploymentAvailable(nextDeployment) {
+		currentDataset, currentDeployment = nextDataset, nextDeployment
+	}
 
-func (r *MotisReconciler) createDataset(ctx context.Context, motis *motisv1alpha1.Motis, log logr.Logger) error {
-	dataset := datasetForMotis(motis)
+	if err := r.reconcileService(ctx, motis, currentDeployment.Spec.Selector.MatchLabels, log); err != nil {
+		log.Error(err, "Failed to reconcile service")
+		return scheduledResult, err
+	}
 
-	if err := ctrl.SetControllerReference(motis, dataset, r.Scheme); err != nil {
-		return err
+	motis.Status.PreviousDataset = ""
+	if previous := findPreviousFinishedDataset(&childDatasets, currentDataset); previous != nil {
+		motis.Status.PreviousDataset = previous.Name
 	}
 
-	log.Info("Creating new Dataset", "Dataset.Namespace", dataset.Namespace, "Dataset.Name", dataset.Name)
-	if err := r.Create(ctx, dataset); err != nil {
-		log.Error(err, "Failed to create new Dataset", "Dataset.Namespace", dataset.Namespace, "Dataset.Name", dataset.Name)
-		return err
+	if err := r.updateStatus(ctx, motis, latestDataset, currentDataset, nextDataset, currentDeployment, nextUpdate); err != nil {
+		log.Error(err, "Failed to update Motis status")
+		return scheduledResult, err
 	}
 
-	return nil
+	retryAfter, err = r.removeOldDeployments(ctx, motis, deployments, currentDeployment, nextDeployment, log)
+	if err != nil {
+		log.Error(err, "Failed to remove old Motis deployments")
+		return scheduledResult, err
+	}
+	requeueAfter(&scheduledResult, retryAfter)
+
+	return scheduledResult, nil
 }
 
-func (r *MotisReconciler) createDeployment(ctx context.Context, motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Dataset, log logr.Logger) error {
-	pod := deploymentForMotis(motis, dataset)
+func (r *MotisReconciler) createDataset(ctx context.Context, motis *motisv1alpha1.Motis, log logr.Logger) (*motisv1alpha1.Dataset, error) {
+	dataset := r.datasetForMotis(motis)
 
-	if err := ctrl.SetControllerReference(motis, pod, r.Scheme); err != nil {
-		log.Error(err, "Error setting controller reference for deployment")
-		return err
+	if err := ctrl.SetControllerReference(motis, dataset, r.Scheme); err != nil {
+		return nil, err
 	}
 
-	log.Info("Creating new motis deployment")
-	if err := r.Create(ctx, pod); err != nil {
-		log.Error(err, "Failed to create motis deployment")
-		return err
+	log.Info("Creating new Dataset", "Dataset.Namespace", dataset.Namespace, "Dataset.Name", dataset.Name)
+	if err := r.Create(ctx, dataset); err != nil {
+		log.Error(err, "Failed to create new Dataset", "Dataset.Namespace", dataset.Namespace, "Dataset.Name", dataset.Name)
+		return nil, err
 	}
 
-	return nil
+	return dataset, nil
 }
 
-func datasetForMotis(motis *motisv1alpha1.Motis) *motisv1alpha1.Dataset {
-	return &motisv1alpha1.Dataset{
+func (r *MotisReconciler) datasetForMotis(motis *motisv1alpha1.Motis) *motisv1alpha1.Dataset {
+	spec := r.specForMotis(motis)
+	dataset := &motisv1alpha1.Dataset{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: motis.Name + "-",
 			Namespace:    motis.Namespace,
 		},
 		Spec: motisv1alpha1.DatasetSpec{
-			Config: motis.Spec.Config,
+			Config:           configForMotis(motis),
+			Credentials:      spec.Credentials,
+			Image:            spec.ProcessingImage,
+			ServerImage:      spec.Image,
+			InitImage:        spec.InitImage,
+			ImagePullSecrets: spec.ImagePullSecrets,
+			ImagePullPolicy:  spec.ImagePullPolicy,
+			InitResources:    spec.InitResources,
+			ImportResources:  spec.ImportResources,
+			PodOverrides:     spec.ProcessingPodOverrides,
+			InputVolume:      spec.InputVolume,
+			DataVolume:       spec.DataVolume,
 		},
 	}
+
+	// Any Dataset created while a rebuild is requested satisfies the request.
+	if token := motis.Annotations[motisv1alpha1.RebuildRequestedAnnotation]; token != "" {
+		dataset.Annotations = map[string]string{motisv1alpha1.RebuildTokenAnnotation: token}
+	}
+	return dataset
 }
 
-func deploymentForMotis(motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Dataset) *appsv1.Deployment {
-	return &appsv1.Deployment{
+func (r *MotisReconciler) deploymentForMotis(motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Dataset) (*appsv1.Deployment, error) {
+	spec := r.specForMotis(motis)
+	startupProbe, readinessProbe, livenessProbe := probesForMotis(spec, dataset)
+	// The volumes are mounted where the Dataset was imported, as its config refers to these paths.
+	datasetSpec := dataset.Spec.DeepCopy()
+	datasetSpec.SetDefaults(r.Defaults)
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      motis.Name,
+			Name:      dataset.Name,
 			Namespace: motis.Namespace,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"motis-project.de/motis-deployment": motis.Name,
+					motisDeploymentLabel: motis.Name,
+					datasetLabel:         dataset.Name,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
-						"motis-project.de/motis-deployment": motis.Name,
-						"motis-project.de/name":             "MotisWeb",
+						motisDeploymentLabel:    motis.Name,
+						datasetLabel:            dataset.Name,
+						"motis-project.de/name": "MotisWeb",
 					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:    "motis",
-							Image:   "ghcr.io/motis-project/motis:latest",
-							Command: []string{"/motis/motis", "--system_config", "/system_config.ini", "-c", "/config/config.ini"},
+							Name:            "motis",
+							Image:           serverImageForDataset(dataset, spec),
+							ImagePullPolicy: spec.ImagePullPolicy,
+							Resources:       spec.ServerResources,
+							Command:         []string{"/motis/motis", "--system_config", "/system_config.ini", "-c", path.Join(datasetSpec.InputVolume.MountPath, importConfigFile), "--server.port", strconv.Itoa(int(spec.Port))},
 							Ports: []corev1.ContainerPort{
 								{
-									ContainerPort: 8080,
+									ContainerPort: spec.Port,
 								},
 							},
+							StartupProbe:   startupProbe,
+							ReadinessProbe: readinessProbe,
+							LivenessProbe:  livenessProbe,
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "data-volume",
-									MountPath: "/data",
+									MountPath: datasetSpec.DataVolume.MountPath,
 								},
 								{
 									Name:      "input-volume",
-									MountPath: "/input",
+									MountPath: datasetSpec.InputVolume.MountPath,
 								},
 								{
 									Name:      "config",
@@ -221,11 +419,17 @@ func deploymentForMotis(motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Datas
 							},
 						},
 					},
-					Volumes: volumesForMotisDeployment(motis, dataset),
+					Volumes:          volumesForMotisDeployment(motis, dataset),
+					ImagePullSecrets: spec.ImagePullSecrets,
 				},
 			},
 		},
 	}
+
+	if err := applyPodOverrides(&deployment.Spec.Template, spec.ServerPodOverrides); err != nil {
+		return nil, err
+	}
+	return deployment, nil
 }
 
 func volumesForMotisDeployment(motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Dataset) []corev1.Volume {
@@ -241,12 +445,23 @@ func volumesForMotisDeployment(motis *motisv1alpha1.Motis, dataset *motisv1alpha
 		{
 			Name: "config",
 			VolumeSource: corev1.VolumeSource{
-				ConfigMap: motis.Spec.Config,
+				ConfigMap: configForMotis(motis),
 			},
 		},
 	}
 }
 
+// specForMotis returns the spec of motis with the fields left unset filled in from the defaults.
+func (r *MotisReconciler) specForMotis(motis *motisv1alpha1.Motis) *motisv1alpha1.MotisSpec {
+	spec := motis.Spec.DeepCopy()
+	spec.SetDefaults(r.Defaults)
+	// Not defaulted by the webhook, so it follows later changes of the image.
+	if spec.ProcessingImage == "" {
+		spec.ProcessingImage = spec.Image
+	}
+	return spec
+}
+
 func findLatestDataset(datasets *[]motisv1alpha1.Dataset) *motisv1alpha1.Dataset {
 	var latestDataset *motisv1alpha1.Dataset
 
@@ -265,6 +480,49 @@ func findLatestDataset(datasets *[]motisv1alpha1.Dataset) *motisv1alpha1.Dataset
 	return latestDataset
 }
 
+// requeueAfter makes result requeue after duration at the latest. A duration of 0 leaves result unchanged.
+func requeueAfter(result *ctrl.Result, duration time.Duration) {
+	if duration > 0 && (result.RequeueAfter == 0 || duration < result.RequeueAfter) {
+		result.RequeueAfter = duration
+	}
+}
+
+// findPreviousFinishedDataset returns the newest of datasets that finished processing
+// and was created before dataset, or nil if there is none.
+func findPreviousFinishedDataset(datasets *[]motisv1alpha1.Dataset, dataset *motisv1alpha1.Dataset) *motisv1alpha1.Dataset {
+	var previous *motisv1alpha1.Dataset
+	for i := range *datasets {
+		candidate := &(*datasets)[i]
+		if !candidate.HasFinishedProcessing() || !candidate.CreationTimestamp.Before(&dataset.CreationTimestamp) {
+			continue
+		}
+		if previous == nil || previous.CreationTimestamp.Before(&candidate.CreationTimestamp) {
+			previous = candidate
+		}
+	}
+	return previous
+}
+
+// rebuildHandled reports whether one of datasets was created for the rebuild token.
+func rebuildHandled(datasets *[]motisv1alpha1.Dataset, token string) bool {
+	for _, dataset := range *datasets {
+		if dataset.Annotations[motisv1alpha1.RebuildTokenAnnotation] == token {
+			return true
+		}
+	}
+	return false
+}
+
+// findDataset returns the Dataset called name, or nil if there is none.
+func findDataset(datasets *[]motisv1alpha1.Dataset, name string) *motisv1alpha1.Dataset {
+	for i := range *datasets {
+		if (*datasets)[i].Name == name {
+			return &(*datasets)[i]
+		}
+	}
+	return nil
+}
+
 func findLatestFinishedDataset(datasets *[]motisv1alpha1.Dataset) *motisv1alpha1.Dataset {
 	var latestFinishedDataset *motisv1alpha1.Dataset
 
@@ -291,5 +549,8 @@ func (r *MotisReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&motisv1alpha1.Motis{}).
 		Owns(&motisv1alpha1.Dataset{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
 		Complete(r)
 }
@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// newTestReconciler returns a MotisReconciler backed by a fake client holding motis
+// and datasets, which are made children of motis.
+func newTestReconciler(t *testing.T, motis *motisv1alpha1.Motis, datasets ...*motisv1alpha1.Dataset) *MotisReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = motisv1alpha1.AddToScheme(scheme)
+
+	objects := []client.Object{motis}
+	for _, dataset := range datasets {
+		if err := ctrl.SetControllerReference(motis, dataset, scheme); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, dataset)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &MotisReconciler{Client: c, Scheme: scheme, APIReader: c}
+}
+
+// childDatasets returns the Datasets of motis stored in the client of r.
+func childDatasets(t *testing.T, r *MotisReconciler, motis *motisv1alpha1.Motis) []motisv1alpha1.Dataset {
+	t.Helper()
+	list := &motisv1alpha1.DatasetList{}
+	if err := r.List(context.Background(), list, client.InNamespace(motis.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+	var datasets []motisv1alpha1.Dataset
+	for _, dataset := range list.Items {
+		if metav1.IsControlledBy(&dataset, motis) {
+			datasets = append(datasets, dataset)
+		}
+	}
+	return datasets
+}
+
+func reconcileMotis(t *testing.T, r *MotisReconciler, motis *motisv1alpha1.Motis) (*motisv1alpha1.Motis, error) {
+	t.Helper()
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(motis)})
+	reconciled := &motisv1alpha1.Motis{}
+	if getErr := r.Get(context.Background(), client.ObjectKeyFromObject(motis), reconciled); getErr != nil {
+		t.Fatal(getErr)
+	}
+	return reconciled, err
+}
+
+// failingDatasetClient fails the creation of every Dataset.
+type failingDatasetClient struct {
+	client.Client
+}
+
+func (c failingDatasetClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*motisv1alpha1.Dataset); ok {
+		return errors.New("creating Datasets is not allowed")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func testMotis() *motisv1alpha1.Motis {
+	return &motisv1alpha1.Motis{
+		ObjectMeta: metav1.ObjectMeta{Name: "motis", Namespace: "default", UID: "motis-uid"},
+	}
+}
+
+func testDataset(name string, created time.Time, condition string) *motisv1alpha1.Dataset {
+	dataset := &motisv1alpha1.Dataset{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(created)},
+	}
+	if condition != "" {
+		dataset.Status.Conditions = []metav1.Condition{{Type: condition, Status: metav1.ConditionTrue, Reason: "Test"}}
+	}
+	return dataset
+}
+
+func TestReconcileRetriesScheduledUpdateAfterFailedCreation(t *testing.T) {
+	motis := testMotis()
+	motis.Spec.UpdateSchedule = "0 * * * *"
+	// The failed latest Dataset makes the scheduled check create a new Dataset.
+	latest := testDataset("motis-failed", time.Now().Add(-2*time.Hour), motisv1alpha1.DatasetFailed)
+	r := newTestReconciler(t, motis, latest)
+	r.Client = failingDatasetClient{r.Client}
+
+	reconciled, err := reconcileMotis(t, r, motis)
+	if err == nil {
+		t.Errorf("Reconcile() succeeded although the Dataset could not be created")
+	}
+	if reconciled.Status.LastUpdateCheck != nil {
+		t.Errorf("Reconcile() recorded the update check at %v although the update failed", reconciled.Status.LastUpdateCheck)
+	}
+}
+
+func TestReconcileRebuildsOncePerToken(t *testing.T) {
+	motis := testMotis()
+	motis.Annotations = map[string]string{motisv1alpha1.RebuildRequestedAnnotation: "first"}
+	ready := testDataset("motis-ready", time.Now().Add(-time.Hour), motisv1alpha1.DatasetReady)
+	// The volumes are set by the Dataset controller and mounted by the Deployment serving the Dataset.
+	ready.Status.InputVolume = &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "motis-ready-input"}}
+	ready.Status.DataVolume = &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "motis-ready-data"}}
+	r := newTestReconciler(t, motis, ready)
+
+	tests := []struct {
+		name         string
+		token        string
+		wantDatasets int
+	}{
+		{"new token", "first", 2},
+		{"unchanged token", "first", 2},
+		{"next token", "second", 3},
+	}
+
+	for _, test := range tests {
+		stored := &motisv1alpha1.Motis{}
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(motis), stored); err != nil {
+			t.Fatal(err)
+		}
+		stored.Annotations[motisv1alpha1.RebuildRequestedAnnotation] = test.token
+		if err := r.Update(context.Background(), stored); err != nil {
+			t.Fatal(err)
+		}
+
+		reconciled, err := reconcileMotis(t, r, motis)
+		if err != nil {
+			t.Fatalf("%v: Reconcile() error = %v", test.name, err)
+		}
+		if datasets := childDatasets(t, r, motis); len(datasets) != test.wantDatasets {
+			t.Errorf("%v: Reconcile() left %d Datasets, want %d", test.name, len(datasets), test.wantDatasets)
+		}
+		if reconciled.Status.LastHandledRebuildToken != test.token {
+			t.Errorf("%v: Reconcile() handled token %q, want %q", test.name, reconciled.Status.LastHandledRebuildToken, test.token)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// The label of the pods importing or serving a Dataset. The operator only caches pods
+// with this label, instead of every pod in the cluster.
+const datasetLabel = "motis-project.de/dataset"
+
+// CacheOptions restricts the cache of the manager to the objects the operator needs.
+func CacheOptions() cache.Options {
+	hasDataset, err := labels.NewRequirement(datasetLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	return cache.Options{
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Pod{}: {Label: labels.NewSelector().Add(*hasDataset)},
+		},
+	}
+}
+
+// ownedDeployments returns the Deployments controlled by motis by name.
+func (r *MotisReconciler) ownedDeployments(ctx context.Context, motis *motisv1alpha1.Motis) (map[string]*appsv1.Deployment, error) {
+	deploymentList := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deploymentList, client.InNamespace(motis.Namespace)); err != nil {
+		return nil, err
+	}
+
+	deployments := map[string]*appsv1.Deployment{}
+	for i := range deploymentList.Items {
+		if metav1.IsControlledBy(&deploymentList.Items[i], motis) {
+			deployments[deploymentList.Items[i].Name] = &deploymentList.Items[i]
+		}
+	}
+	return deployments, nil
+}
+
+// reconcileDeployment creates the Deployment serving dataset, or updates current if it exists.
+func (r *MotisReconciler) reconcileDeployment(ctx context.Context, motis *motisv1alpha1.Motis, dataset *motisv1alpha1.Dataset, current *appsv1.Deployment, log logr.Logger) (*appsv1.Deployment, error) {
+	desired, err := r.deploymentForMotis(motis, dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		if err := ctrl.SetControllerReference(motis, desired, r.Scheme); err != nil {
+			return nil, err
+		}
+
+		log.Info("Creating new motis deployment", "Deployment.Name", desired.Name)
+		if err := r.Create(ctx, desired); err != nil {
+			return nil, err
+		}
+		return desired, nil
+	}
+
+	// Fields left empty in the desired template are defaulted by Kubernetes, so they are ignored.
+	if equality.Semantic.DeepDerivative(desired.Spec.Template, current.Spec.Template) {
+		return current, nil
+	}
+
+	log.Info("Updating motis deployment", "Deployment.Name", current.Name)
+	current.Spec.Template = desired.Spec.Template
+	if err := r.Update(ctx, current); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// deploymentAvailable reports whether all replicas of deployment run its latest template.
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.UID != "" &&
+		deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.AvailableReplicas >= replicas
+}
+
+// removeOldDeployments deletes the Deployments of motis serving neither the current nor the
+// next Dataset, once the grace period after the last switch passed. It returns the time
+// until the grace period ends, or 0 if there is nothing left to delete.
+//
+// The single Deployment of operator versions before blue/green switchovers selects the
+// pods of all Deployments of motis, so it is deleted right after the switch instead.
+func (r *MotisReconciler) removeOldDeployments(ctx context.Context, motis *motisv1alpha1.Motis, deployments map[string]*appsv1.Deployment, current *appsv1.Deployment, next *appsv1.Deployment, log logr.Logger) (time.Duration, error) {
+	gracePeriod := r.specForMotis(motis).SwitchoverGracePeriod.Duration
+	var remaining time.Duration
+	if motis.Status.LastUpdateTime != nil {
+		remaining = time.Until(motis.Status.LastUpdateTime.Add(gracePeriod))
+	}
+
+	var retryAfter time.Duration
+	for name, deployment := range deployments {
+		if name == current.Name || name == next.Name {
+			continue
+		}
+		if remaining > 0 && !isLegacyDeployment(motis, deployment) {
+			retryAfter = remaining
+			continue
+		}
+
+		log.Info("Deleting old motis deployment", "Deployment.Name", name)
+		if err := r.Delete(ctx, deployment); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// isLegacyDeployment reports whether deployment is the single Deployment of motis created
+// by operator versions before blue/green switchovers, which does not select a Dataset.
+func isLegacyDeployment(motis *motisv1alpha1.Motis, deployment *appsv1.Deployment) bool {
+	if deployment.Name != motis.Name {
+		return false
+	}
+	return deployment.Spec.Selector == nil || deployment.Spec.Selector.MatchLabels[datasetLabel] == ""
+}
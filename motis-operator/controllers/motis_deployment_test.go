@@ -0,0 +1,139 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestReconcileDeploymentUpdatesOnlyChangedTemplates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = motisv1alpha1.AddToScheme(scheme)
+	r := &MotisReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	ctx := context.Background()
+	motis := &motisv1alpha1.Motis{ObjectMeta: metav1.ObjectMeta{Name: "motis", Namespace: "default", UID: "uid"}}
+	motis.Spec.Image = "motis:1"
+	dataset := &motisv1alpha1.Dataset{ObjectMeta: metav1.ObjectMeta{Name: "motis-abc", Namespace: "default"}}
+	dataset.Status.DataVolume = &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}
+	dataset.Status.InputVolume = &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "input"}}
+
+	created, err := r.reconcileDeployment(ctx, motis, dataset, nil, logr.Discard())
+	if err != nil {
+		t.Fatalf("reconcileDeployment() error = %v", err)
+	}
+
+	current := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(created), current); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a field defaulted by Kubernetes.
+	current.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	if err := r.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	version := current.ResourceVersion
+
+	if _, err := r.reconcileDeployment(ctx, motis, dataset, current.DeepCopy(), logr.Discard()); err != nil {
+		t.Fatalf("reconcileDeployment() error = %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(created), current); err != nil {
+		t.Fatal(err)
+	}
+	if current.ResourceVersion != version {
+		t.Errorf("reconcileDeployment() updated an unchanged Deployment")
+	}
+
+	motis.Spec.Image = "motis:2"
+	if _, err := r.reconcileDeployment(ctx, motis, dataset, current.DeepCopy(), logr.Discard()); err != nil {
+		t.Fatalf("reconcileDeployment() error = %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(created), current); err != nil {
+		t.Fatal(err)
+	}
+	if image := current.Spec.Template.Spec.Containers[0].Image; image != "motis:2" {
+		t.Errorf("reconcileDeployment() left image %q, want %q", image, "motis:2")
+	}
+}
+
+func TestIsLegacyDeployment(t *testing.T) {
+	motis := &motisv1alpha1.Motis{ObjectMeta: metav1.ObjectMeta{Name: "motis"}}
+	tests := []struct {
+		name     string
+		selector map[string]string
+		want     bool
+	}{
+		{"motis", map[string]string{motisDeploymentLabel: "motis"}, true},
+		{"motis", map[string]string{motisDeploymentLabel: "motis", datasetLabel: "motis"}, false},
+		{"motis-abc", map[string]string{motisDeploymentLabel: "motis", datasetLabel: "motis-abc"}, false},
+	}
+
+	for _, test := range tests {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: test.name},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: test.selector}},
+		}
+		if got := isLegacyDeployment(motis, deployment); got != test.want {
+			t.Errorf("isLegacyDeployment(%v, %v) = %v, want %v", test.name, test.selector, got, test.want)
+		}
+	}
+}
+
+func TestCacheOptionsSelectOnlyDatasetPods(t *testing.T) {
+	selectors := CacheOptions().SelectorsByObject
+	if len(selectors) != 1 {
+		t.Fatalf("CacheOptions() restricts %d types, want only pods", len(selectors))
+	}
+	var selector cache.ObjectSelector
+	for object, s := range selectors {
+		if _, ok := object.(*corev1.Pod); !ok {
+			t.Fatalf("CacheOptions() restricts %T, want only pods", object)
+		}
+		selector = s
+	}
+
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{datasetLabel: "motis-abc", "job-name": "motis-abc"}, true},
+		{map[string]string{datasetLabel: "motis-abc", motisDeploymentLabel: "motis"}, true},
+		{map[string]string{"app": "other"}, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := selector.Label.Matches(labels.Set(test.labels)); got != test.want {
+			t.Errorf("cache selector matches %v = %v, want %v", test.labels, got, test.want)
+		}
+	}
+}
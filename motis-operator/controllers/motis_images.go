@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// imagesChanged reports whether dataset was built with other images than the ones in spec.
+// Images a Dataset did not record, e.g. as it was created by an older operator, are unknown
+// and do not count as changed, so upgrading the operator does not rebuild every Dataset.
+func imagesChanged(dataset *motisv1alpha1.Dataset, spec *motisv1alpha1.MotisSpec) bool {
+	return (dataset.Spec.Image != "" && dataset.Spec.Image != spec.ProcessingImage) ||
+		(dataset.Spec.ServerImage != "" && dataset.Spec.ServerImage != spec.Image) ||
+		(dataset.Spec.InitImage != "" && dataset.Spec.InitImage != spec.InitImage)
+}
+
+// imagesOf returns the images of spec in the format of the lastImageRebuild status field.
+func imagesOf(spec *motisv1alpha1.MotisSpec) string {
+	return strings.Join([]string{spec.ProcessingImage, spec.Image, spec.InitImage}, " ")
+}
+
+// serverImageForDataset returns the image serving dataset. If the Dataset is served by the
+// image which imported it, the image is pinned to the digest of the import, so a moved tag
+// cannot mount the data into another MOTIS version.
+func serverImageForDataset(dataset *motisv1alpha1.Dataset, spec *motisv1alpha1.MotisSpec) string {
+	image := dataset.Spec.ServerImage
+	if image == "" {
+		image = spec.Image
+	}
+
+	if image == dataset.Spec.Image && dataset.Status.ImageDigest != "" {
+		return imageWithDigest(image, dataset.Status.ImageDigest)
+	}
+	return image
+}
+
+// imageWithDigest replaces the tag or digest of image by digest.
+func imageWithDigest(image string, digest string) string {
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + "@" + digest
+}
+
+// importDigest returns the digest of the MOTIS image of the processing pod which
+// finished the import, or an empty string if no pod finished.
+func importDigest(processingPods *corev1.PodList) string {
+	for _, pod := range processingPods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != "motis" || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			if digest := digestFromImageID(status.ImageID); digest != "" {
+				return digest
+			}
+		}
+	}
+	return ""
+}
+
+// digestFromImageID returns the digest of an image ID reported by the kubelet, e.g.
+// docker-pullable://ghcr.io/motis-project/motis@sha256:9f86d081884c7d65...
+// Image IDs without a repository digest, such as of images which were never pulled, yield "".
+func digestFromImageID(imageID string) string {
+	_, digest, found := strings.Cut(imageID, "@")
+	if !found || !strings.HasPrefix(digest, "sha256:") {
+		return ""
+	}
+	return digest
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import "testing"
+
+const testDigest = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestImageWithDigest(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"motis", "motis@" + testDigest},
+		{"ghcr.io/motis-project/motis:0.9", "ghcr.io/motis-project/motis@" + testDigest},
+		{"localhost:5000/motis", "localhost:5000/motis@" + testDigest},
+		{"localhost:5000/motis:latest", "localhost:5000/motis@" + testDigest},
+		{"ghcr.io/motis-project/motis@sha256:0000000000000000000000000000000000000000000000000000000000000000", "ghcr.io/motis-project/motis@" + testDigest},
+		{"ghcr.io/motis-project/motis:0.9@sha256:0000000000000000000000000000000000000000000000000000000000000000", "ghcr.io/motis-project/motis@" + testDigest},
+	}
+
+	for _, test := range tests {
+		if got := imageWithDigest(test.image, testDigest); got != test.want {
+			t.Errorf("imageWithDigest(%q) = %q, want %q", test.image, got, test.want)
+		}
+	}
+}
+
+func TestDigestFromImageID(t *testing.T) {
+	tests := []struct {
+		imageID string
+		want    string
+	}{
+		{"docker-pullable://ghcr.io/motis-project/motis@" + testDigest, testDigest},
+		{"ghcr.io/motis-project/motis@" + testDigest, testDigest},
+		{"localhost:5000/motis@" + testDigest, testDigest},
+		// Images which were never pulled from a registry have no repository digest.
+		{"sha256:2b1e6e5c9f4c1f0cd8b7bd94a7a2e5d1d2c4d7f8a9b0c1d2e3f4a5b6c7d8e9f0", ""},
+		{"docker://sha256:2b1e6e5c9f4c1f0cd8b7bd94a7a2e5d1d2c4d7f8a9b0c1d2e3f4a5b6c7d8e9f0", ""},
+		{"ghcr.io/motis-project/motis@md5:d41d8cd98f00b204e9800998ecf8427e", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := digestFromImageID(test.imageID); got != test.want {
+			t.Errorf("digestFromImageID(%q) = %q, want %q", test.imageID, got, test.want)
+		}
+	}
+}
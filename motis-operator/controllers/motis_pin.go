@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// rollback handles the rollback annotation of motis by pinning the newest Dataset that
+// finished processing before the current one. As the previous Dataset is derived from the
+// current one, rolling back twice moves two Datasets back instead of returning to the
+// current Dataset. The annotation is removed in any case, so a rollback is only attempted once.
+func (r *MotisReconciler) rollback(ctx context.Context, motis *motisv1alpha1.Motis, log logr.Logger) error {
+	delete(motis.Annotations, motisv1alpha1.RollbackAnnotation)
+
+	previous := motis.Status.PreviousDataset
+	if previous == "" {
+		log.Info("Ignoring rollback request, since no Dataset finished processing before the current one")
+		return r.Update(ctx, motis)
+	}
+
+	dataset := &motisv1alpha1.Dataset{}
+	if err := r.Get(ctx, types.NamespacedName{Name: previous, Namespace: motis.Namespace}, dataset); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		log.Info("Ignoring rollback request, since the previous Dataset no longer exists", "Dataset.Name", previous)
+		return r.Update(ctx, motis)
+	}
+
+	log.Info("Rolling back to the previous Dataset", "Dataset.Name", previous)
+	motis.Spec.PinnedDataset = previous
+	return r.Update(ctx, motis)
+}
+
+// datasetToServe returns the Dataset motis should serve: the pinned Dataset if one is
+// pinned, and the latest finished Dataset otherwise. While the pinned Dataset is not
+// ready, the current Dataset is served.
+func datasetToServe(motis *motisv1alpha1.Motis, datasets *[]motisv1alpha1.Dataset, latestFinished *motisv1alpha1.Dataset, log logr.Logger) *motisv1alpha1.Dataset {
+	if motis.Spec.PinnedDataset == "" {
+		return latestFinished
+	}
+
+	pinned := findDataset(datasets, motis.Spec.PinnedDataset)
+	if pinned != nil && pinned.HasFinishedProcessing() {
+		return pinned
+	}
+
+	log.Info("The pinned Dataset is not ready. Keeping the current Dataset.", "Dataset.Name", motis.Spec.PinnedDataset)
+	if current := findDataset(datasets, motis.Status.CurrentDataset); current != nil {
+		return current
+	}
+	return latestFinished
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestRollback(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		previous   string
+		wantPinned string
+	}{
+		{"previous Dataset", "motis-previous", "motis-previous"},
+		{"no previous Dataset", "", ""},
+		{"deleted previous Dataset", "motis-deleted", ""},
+	}
+
+	for _, test := range tests {
+		motis := testMotis()
+		motis.Annotations = map[string]string{motisv1alpha1.RollbackAnnotation: "true"}
+		motis.Status.CurrentDataset = "motis-current"
+		motis.Status.PreviousDataset = test.previous
+		r := newTestReconciler(t, motis,
+			testDataset("motis-current", now.Add(-time.Hour), motisv1alpha1.DatasetReady),
+			testDataset("motis-previous", now.Add(-2*time.Hour), motisv1alpha1.DatasetReady),
+		)
+
+		stored := &motisv1alpha1.Motis{}
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(motis), stored); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.rollback(context.Background(), stored, logr.Discard()); err != nil {
+			t.Errorf("%v: rollback() error = %v", test.name, err)
+			continue
+		}
+
+		rolledBack := &motisv1alpha1.Motis{}
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(motis), rolledBack); err != nil {
+			t.Fatal(err)
+		}
+		if rolledBack.Spec.PinnedDataset != test.wantPinned {
+			t.Errorf("%v: rollback() pinned %q, want %q", test.name, rolledBack.Spec.PinnedDataset, test.wantPinned)
+		}
+		if _, ok := rolledBack.Annotations[motisv1alpha1.RollbackAnnotation]; ok {
+			t.Errorf("%v: rollback() kept the %v annotation", test.name, motisv1alpha1.RollbackAnnotation)
+		}
+	}
+}
+
+func TestDatasetToServe(t *testing.T) {
+	now := time.Now()
+	datasets := []motisv1alpha1.Dataset{
+		*testDataset("motis-latest", now.Add(-time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("motis-current", now.Add(-2*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("motis-previous", now.Add(-3*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("motis-processing", now.Add(-10*time.Minute), ""),
+		*testDataset("motis-failed", now.Add(-20*time.Minute), motisv1alpha1.DatasetFailed),
+	}
+	latestFinished := &datasets[0]
+
+	tests := []struct {
+		name    string
+		pinned  string
+		current string
+		want    string
+	}{
+		{"nothing pinned", "", "motis-current", "motis-latest"},
+		{"pinned previous Dataset", "motis-previous", "motis-current", "motis-previous"},
+		{"pinned Dataset still processing", "motis-processing", "motis-current", "motis-current"},
+		{"pinned failed Dataset", "motis-failed", "motis-current", "motis-current"},
+		{"pinned Dataset does not exist", "motis-unknown", "motis-current", "motis-current"},
+		{"pinned Dataset not ready without current Dataset", "motis-processing", "", "motis-latest"},
+	}
+
+	for _, test := range tests {
+		motis := testMotis()
+		motis.Spec.PinnedDataset = test.pinned
+		motis.Status.CurrentDataset = test.current
+
+		if got := datasetToServe(motis, &datasets, latestFinished, logr.Discard()); got == nil || got.Name != test.want {
+			t.Errorf("%v: datasetToServe() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
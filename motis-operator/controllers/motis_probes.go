@@ -0,0 +1,140 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+const (
+	// The time MOTIS gets to load any Dataset.
+	startupBaseBudget = 10 * time.Minute
+	// The additional time MOTIS gets to load each startupBytesPerMinute of downloaded data.
+	startupBytesPerMinute = 100 << 20
+	// The time MOTIS gets to load a Dataset whose size is unknown, because the
+	// init container truncated its inputs and did not report their combined size.
+	startupUnknownSizeBudget = 2 * time.Hour
+)
+
+// probesForMotis returns the startup, readiness and liveness probes of the MOTIS server
+// serving dataset. Loading a large Dataset takes long, so the budget of the startup
+// probe grows with the size of the downloaded schedules and map data.
+func probesForMotis(spec *motisv1alpha1.MotisSpec, dataset *motisv1alpha1.Dataset) (startup *corev1.Probe, readiness *corev1.Probe, liveness *corev1.Probe) {
+	startup = httpProbe(spec.Port, 10, 5, 0)
+	overrideProbe(startup, spec.StartupProbe)
+	// The budget is spread over the effective period, unless the threshold is overridden.
+	if spec.StartupProbe == nil || spec.StartupProbe.FailureThreshold == nil {
+		startup.FailureThreshold = startupFailureThreshold(startupBudget(dataset), startup.PeriodSeconds)
+	}
+
+	readiness = httpProbe(spec.Port, 10, 5, 3)
+	overrideProbe(readiness, spec.ReadinessProbe)
+
+	liveness = httpProbe(spec.Port, 20, 10, 6)
+	overrideProbe(liveness, spec.LivenessProbe)
+
+	return startup, readiness, liveness
+}
+
+// startupBudget returns how long MOTIS may take to load dataset.
+func startupBudget(dataset *motisv1alpha1.Dataset) time.Duration {
+	size := dataset.Status.InputsSize
+	if size == 0 {
+		if dataset.Status.InputsTruncated {
+			return startupUnknownSizeBudget
+		}
+		for _, input := range dataset.Status.Inputs {
+			size += input.Size
+		}
+	}
+	return startupBaseBudget + time.Duration(size/startupBytesPerMinute)*time.Minute
+}
+
+// startupFailureThreshold returns how many failed probes every periodSeconds fit into budget.
+func startupFailureThreshold(budget time.Duration, periodSeconds int32) int32 {
+	period := time.Duration(periodSeconds) * time.Second
+	if period <= 0 {
+		// Kubernetes defaults the period to 10 seconds.
+		period = 10 * time.Second
+	}
+	threshold := int32((budget + period - 1) / period)
+	if threshold < 1 {
+		threshold = 1
+	}
+	return threshold
+}
+
+func httpProbe(port int32, periodSeconds int32, timeoutSeconds int32, failureThreshold int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/",
+				Port: intstr.FromInt(int(port)),
+			},
+		},
+		PeriodSeconds:    periodSeconds,
+		TimeoutSeconds:   timeoutSeconds,
+		FailureThreshold: failureThreshold,
+	}
+}
+
+// overrideProbe sets the thresholds of probe from the fields set in overrides.
+func overrideProbe(probe *corev1.Probe, overrides *motisv1alpha1.ProbeSpec) {
+	if overrides == nil {
+		return
+	}
+	if overrides.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *overrides.InitialDelaySeconds
+	}
+	if overrides.PeriodSeconds != nil {
+		probe.PeriodSeconds = *overrides.PeriodSeconds
+	}
+	if overrides.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *overrides.TimeoutSeconds
+	}
+	if overrides.FailureThreshold != nil {
+		probe.FailureThreshold = *overrides.FailureThreshold
+	}
+}
+
+// serverPodProblem explains why none of pods serves requests, judging by the
+// probes of their MOTIS container. It returns empty strings if no pod has started.
+func serverPodProblem(pods []corev1.Pod) (reason string, message string) {
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != "motis" {
+				continue
+			}
+
+			switch {
+			case status.State.Waiting != nil && status.RestartCount > 0:
+				reason, message = "ServerRestarting", fmt.Sprintf("The MOTIS server in pod %v restarted %d times: %v", pod.Name, status.RestartCount, status.State.Waiting.Reason)
+			case status.State.Running != nil && (status.Started == nil || !*status.Started):
+				return "ServerStarting", fmt.Sprintf("The MOTIS server in pod %v is loading its Dataset", pod.Name)
+			case status.State.Running != nil && !status.Ready:
+				return "ReadinessProbeFailed", fmt.Sprintf("The MOTIS server in pod %v fails its readiness probe", pod.Name)
+			}
+		}
+	}
+	return reason, message
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestStartupBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		status motisv1alpha1.DatasetStatus
+		want   time.Duration
+	}{
+		{"no inputs", motisv1alpha1.DatasetStatus{}, startupBaseBudget},
+		{"inputs", motisv1alpha1.DatasetStatus{Inputs: []motisv1alpha1.DatasetInput{{Size: 300 << 20}, {Size: 200 << 20}}}, startupBaseBudget + 5*time.Minute},
+		{"reported size", motisv1alpha1.DatasetStatus{Inputs: []motisv1alpha1.DatasetInput{{Size: 100 << 20}}, InputsSize: 1 << 30, InputsTruncated: true}, startupBaseBudget + 10*time.Minute},
+		{"truncated without size", motisv1alpha1.DatasetStatus{Inputs: []motisv1alpha1.DatasetInput{{Size: 100 << 20}}, InputsTruncated: true}, startupUnknownSizeBudget},
+	}
+
+	for _, test := range tests {
+		if got := startupBudget(&motisv1alpha1.Dataset{Status: test.status}); got != test.want {
+			t.Errorf("%v: startupBudget() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStartupProbeBudgetFollowsPeriodOverride(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+	tests := []struct {
+		name          string
+		overrides     *motisv1alpha1.ProbeSpec
+		wantPeriod    int32
+		wantThreshold int32
+	}{
+		{"defaults", nil, 10, int32(startupBaseBudget / (10 * time.Second))},
+		{"period", &motisv1alpha1.ProbeSpec{PeriodSeconds: int32Ptr(30)}, 30, int32(startupBaseBudget / (30 * time.Second))},
+		{"period and threshold", &motisv1alpha1.ProbeSpec{PeriodSeconds: int32Ptr(30), FailureThreshold: int32Ptr(5)}, 30, 5},
+		{"threshold", &motisv1alpha1.ProbeSpec{FailureThreshold: int32Ptr(7)}, 10, 7},
+	}
+
+	for _, test := range tests {
+		spec := &motisv1alpha1.MotisSpec{Port: 8080, StartupProbe: test.overrides}
+		startup, _, _ := probesForMotis(spec, &motisv1alpha1.Dataset{})
+		if startup.PeriodSeconds != test.wantPeriod || startup.FailureThreshold != test.wantThreshold {
+			t.Errorf("%v: startup probe period %d, threshold %d, want %d, %d", test.name, startup.PeriodSeconds, startup.FailureThreshold, test.wantPeriod, test.wantThreshold)
+		}
+	}
+}
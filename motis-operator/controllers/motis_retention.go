@@ -0,0 +1,123 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// removeOldDatasets deletes the Datasets of motis which fall outside its retention policy.
+// Datasets in protected, and Datasets still processing, are never deleted. The volumes and
+// jobs of a deleted Dataset are garbage collected by Kubernetes. It returns the time until
+// the next failed Dataset expires, or 0 if no failed Dataset is left.
+func (r *MotisReconciler) removeOldDatasets(ctx context.Context, motis *motisv1alpha1.Motis, datasets []motisv1alpha1.Dataset, protected map[string]bool, log logr.Logger) (time.Duration, error) {
+	retention := r.specForMotis(motis).Retention
+	expired, retryAfter := r.expiredDatasets(retention, datasets, protected)
+
+	for _, dataset := range expired {
+		log.Info("Deleting old Dataset", "Dataset.Name", dataset.Name)
+		if err := r.Delete(ctx, dataset, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// expiredDatasets returns the datasets to delete under retention, oldest first, and the
+// time until the next failed Dataset expires.
+func (r *MotisReconciler) expiredDatasets(retention *motisv1alpha1.RetentionPolicy, datasets []motisv1alpha1.Dataset, protected map[string]bool) ([]*motisv1alpha1.Dataset, time.Duration) {
+	sorted := make([]*motisv1alpha1.Dataset, 0, len(datasets))
+	for i := range datasets {
+		sorted = append(sorted, &datasets[i])
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	var expired, kept []*motisv1alpha1.Dataset
+	var retryAfter time.Duration
+	readyCount := int32(0)
+	for _, dataset := range sorted {
+		switch {
+		case dataset.HasFinishedProcessing():
+			readyCount++
+			if readyCount > *retention.KeepReady && !protected[dataset.Name] {
+				expired = append(expired, dataset)
+				continue
+			}
+		case dataset.HasFailed():
+			failed := meta.FindStatusCondition(dataset.Status.Conditions, motisv1alpha1.DatasetFailed)
+			remaining := time.Until(failed.LastTransitionTime.Add(retention.KeepFailedFor.Duration))
+			if remaining <= 0 && !protected[dataset.Name] {
+				expired = append(expired, dataset)
+				continue
+			}
+			if remaining > 0 && (retryAfter == 0 || remaining < retryAfter) {
+				retryAfter = remaining
+			}
+		}
+		kept = append(kept, dataset)
+	}
+
+	if retention.MaxTotalSize != nil {
+		var total int64
+		for _, dataset := range kept {
+			total += r.datasetSize(dataset)
+		}
+
+		// Oldest first, failed Datasets before the ones that finished processing.
+		for _, failed := range []bool{true, false} {
+			for i := len(kept) - 1; i >= 0 && total > retention.MaxTotalSize.Value(); i-- {
+				dataset := kept[i]
+				if protected[dataset.Name] || dataset.HasFailed() != failed || (!failed && !dataset.HasFinishedProcessing()) {
+					continue
+				}
+				expired = append(expired, dataset)
+				total -= r.datasetSize(dataset)
+			}
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].CreationTimestamp.Before(&expired[j].CreationTimestamp)
+	})
+	return expired, retryAfter
+}
+
+// datasetSize returns the requested size of the volumes of dataset in bytes.
+func (r *MotisReconciler) datasetSize(dataset *motisv1alpha1.Dataset) int64 {
+	spec := dataset.Spec.DeepCopy()
+	spec.SetDefaults(r.Defaults)
+
+	var size int64
+	for _, volume := range []*motisv1alpha1.VolumeSpec{spec.InputVolume, spec.DataVolume} {
+		if volume.Size != nil {
+			size += volume.Size.Value()
+		}
+	}
+	return size
+}
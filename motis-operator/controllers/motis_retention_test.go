@@ -0,0 +1,101 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1alpha1 "github.com/vstollen/motis-operator/api/config/v1alpha1"
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestExpiredDatasets(t *testing.T) {
+	now := time.Now()
+	failed := func(name string, created time.Time, failedAt time.Time) motisv1alpha1.Dataset {
+		dataset := testDataset(name, created, motisv1alpha1.DatasetFailed)
+		dataset.Status.Conditions[0].LastTransitionTime = metav1.NewTime(failedAt)
+		return *dataset
+	}
+	datasets := []motisv1alpha1.Dataset{
+		*testDataset("ready-1", now.Add(-1*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("ready-3", now.Add(-3*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("ready-2", now.Add(-2*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("ready-4", now.Add(-4*time.Hour), motisv1alpha1.DatasetReady),
+		*testDataset("processing", now.Add(-5*time.Hour), ""),
+		failed("failed-recently", now.Add(-90*time.Minute), now.Add(-90*time.Minute)),
+		failed("failed-long-ago", now.Add(-31*time.Hour), now.Add(-30*time.Hour)),
+		failed("failed-protected", now.Add(-32*time.Hour), now.Add(-30*time.Hour)),
+	}
+
+	keep := func(n int32) *int32 { return &n }
+	size := func(s string) *resource.Quantity { q := resource.MustParse(s); return &q }
+	keepFailedFor := &metav1.Duration{Duration: 24 * time.Hour}
+
+	tests := []struct {
+		name      string
+		retention motisv1alpha1.RetentionPolicy
+		protected []string
+		want      []string
+	}{
+		{
+			"keep ready and failed for",
+			motisv1alpha1.RetentionPolicy{KeepReady: keep(2), KeepFailedFor: keepFailedFor},
+			[]string{"failed-protected"},
+			[]string{"failed-long-ago", "ready-4", "ready-3"},
+		},
+		{
+			"served and pinned Datasets are kept",
+			motisv1alpha1.RetentionPolicy{KeepReady: keep(1), KeepFailedFor: keepFailedFor},
+			[]string{"ready-1", "ready-3", "failed-protected"},
+			[]string{"failed-long-ago", "ready-4", "ready-2"},
+		},
+		{
+			"max total size",
+			// Every Dataset has two volumes of 1Gi.
+			motisv1alpha1.RetentionPolicy{KeepReady: keep(10), KeepFailedFor: keepFailedFor, MaxTotalSize: size("6Gi")},
+			[]string{"ready-1", "ready-3", "failed-protected"},
+			[]string{"failed-long-ago", "ready-4", "ready-2", "failed-recently"},
+		},
+	}
+
+	r := &MotisReconciler{Defaults: configv1alpha1.Defaults{InputVolumeSize: size("1Gi"), DataVolumeSize: size("1Gi")}}
+	for _, test := range tests {
+		protected := map[string]bool{}
+		for _, name := range test.protected {
+			protected[name] = true
+		}
+
+		expired, retryAfter := r.expiredDatasets(&test.retention, datasets, protected)
+
+		var got []string
+		for _, dataset := range expired {
+			got = append(got, dataset.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: expiredDatasets() = %v, want %v", test.name, got, test.want)
+		}
+		// The recently failed Dataset expires 24h after it failed.
+		if want := 22*time.Hour + 30*time.Minute; retryAfter > want || retryAfter < want-time.Minute {
+			t.Errorf("%v: expiredDatasets() retry after %v, want %v", test.name, retryAfter, want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// The label selecting the pods of the MOTIS server of a Motis.
+const motisDeploymentLabel = "motis-project.de/motis-deployment"
+
+// The annotation listing the annotations of a Service or Ingress taken from the Motis spec.
+const managedAnnotationsAnnotation = "motis-project.de/managed-annotations"
+
+// reconcileService creates or updates the Service exposing the MOTIS server of motis.
+// The Service routes to the pods matching selector, so switching the selector switches
+// the Dataset being served.
+func (r *MotisReconciler) reconcileService(ctx context.Context, motis *motisv1alpha1.Motis, selector map[string]string, log logr.Logger) error {
+	desired := r.serviceForMotis(motis, selector)
+	if err := ctrl.SetControllerReference(motis, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	current := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if errors.IsNotFound(err) {
+		log.Info("Creating service", "Service.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+
+	// Node ports allocated by Kubernetes are kept, unless the Service no longer has node ports.
+	if desired.Spec.Type != corev1.ServiceTypeClusterIP {
+		for i := range desired.Spec.Ports {
+			for _, port := range current.Spec.Ports {
+				if desired.Spec.Ports[i].NodePort == 0 && port.Name == desired.Spec.Ports[i].Name {
+					desired.Spec.Ports[i].NodePort = port.NodePort
+				}
+			}
+		}
+	}
+
+	if current.Spec.Type == desired.Spec.Type &&
+		reflect.DeepEqual(current.Spec.Ports, desired.Spec.Ports) &&
+		reflect.DeepEqual(current.Spec.Selector, desired.Spec.Selector) &&
+		reflect.DeepEqual(current.Annotations, managedAnnotations(current.Annotations, desired.Annotations)) {
+		return nil
+	}
+
+	log.Info("Updating service", "Service.Name", desired.Name)
+	current.Spec.Type = desired.Spec.Type
+	current.Spec.Ports = desired.Spec.Ports
+	current.Spec.Selector = desired.Spec.Selector
+	current.Annotations = managedAnnotations(current.Annotations, desired.Annotations)
+	return r.Update(ctx, current)
+}
+
+func (r *MotisReconciler) serviceForMotis(motis *motisv1alpha1.Motis, selector map[string]string) *corev1.Service {
+	spec := r.specForMotis(motis)
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        motis.Name,
+			Namespace:   motis.Namespace,
+			Annotations: managedAnnotations(nil, spec.Service.Annotations),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     spec.Service.Type,
+			Selector: selector,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       spec.Service.Port,
+					TargetPort: intstr.FromInt(int(spec.Port)),
+					NodePort:   spec.Service.NodePort,
+				},
+			},
+		},
+	}
+}
+
+// reconcileIngress creates, updates or deletes the Ingress of motis.
+func (r *MotisReconciler) reconcileIngress(ctx context.Context, motis *motisv1alpha1.Motis, log logr.Logger) error {
+	current := &networkingv1.Ingress{}
+	err := r.Get(ctx, types.NamespacedName{Name: motis.Name, Namespace: motis.Namespace}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if motis.Spec.Ingress == nil {
+		if found && metav1.IsControlledBy(current, motis) {
+			log.Info("Deleting ingress", "Ingress.Name", current.Name)
+			return r.Delete(ctx, current)
+		}
+		return nil
+	}
+
+	desired := r.ingressForMotis(motis)
+	if err := ctrl.SetControllerReference(motis, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	if !found {
+		log.Info("Creating ingress", "Ingress.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+
+	if reflect.DeepEqual(current.Spec, desired.Spec) &&
+		reflect.DeepEqual(current.Annotations, managedAnnotations(current.Annotations, desired.Annotations)) {
+		return nil
+	}
+
+	log.Info("Updating ingress", "Ingress.Name", desired.Name)
+	current.Spec = desired.Spec
+	current.Annotations = managedAnnotations(current.Annotations, desired.Annotations)
+	return r.Update(ctx, current)
+}
+
+func (r *MotisReconciler) ingressForMotis(motis *motisv1alpha1.Motis) *networkingv1.Ingress {
+	spec := r.specForMotis(motis)
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        motis.Name,
+			Namespace:   motis.Namespace,
+			Annotations: managedAnnotations(nil, spec.Ingress.Annotations),
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: spec.Ingress.ClassName,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: spec.Ingress.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     spec.Ingress.Path,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: motis.Name,
+											Port: networkingv1.ServiceBackendPort{Number: spec.Service.Port},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if spec.Ingress.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      []string{spec.Ingress.Host},
+				SecretName: spec.Ingress.TLSSecretName,
+			},
+		}
+	}
+
+	return ingress
+}
+
+// urlForMotis returns the external URL of the MOTIS web interface of motis, or an
+// empty string if neither an Ingress nor a LoadBalancer Service exposes it.
+func urlForMotis(spec *motisv1alpha1.MotisSpec, service *corev1.Service) string {
+	if spec.Ingress != nil {
+		u := url.URL{Scheme: "http", Host: spec.Ingress.Host, Path: spec.Ingress.Path}
+		if spec.Ingress.TLSSecretName != "" {
+			u.Scheme = "https"
+		}
+		return u.String()
+	}
+
+	if service == nil || service.Spec.Type != corev1.ServiceTypeLoadBalancer || len(service.Spec.Ports) == 0 {
+		return ""
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		host := ingress.Hostname
+		if host == "" {
+			host = ingress.IP
+		}
+		if host != "" {
+			return fmt.Sprintf("http://%v:%d", host, service.Spec.Ports[0].Port)
+		}
+	}
+	return ""
+}
+
+// managedAnnotations returns current with the annotations taken from the spec replaced
+// by annotations. Annotations removed from the spec are removed as well, while
+// annotations added by others, e.g. a cloud controller, are kept.
+func managedAnnotations(current map[string]string, annotations map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range current {
+		result[key] = value
+	}
+	for _, key := range strings.Split(current[managedAnnotationsAnnotation], ",") {
+		delete(result, key)
+	}
+	delete(result, managedAnnotationsAnnotation)
+
+	var keys []string
+	for key, value := range annotations {
+		if key == managedAnnotationsAnnotation {
+			continue
+		}
+		result[key] = value
+		keys = append(keys, key)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		result[managedAnnotationsAnnotation] = strings.Join(keys, ",")
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestManagedAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     map[string]string
+		annotations map[string]string
+		want        map[string]string
+	}{
+		{"none", nil, nil, nil},
+		{"new", nil, map[string]string{"b": "2", "a": "1"}, map[string]string{"a": "1", "b": "2", managedAnnotationsAnnotation: "a,b"}},
+		{
+			name:        "unchanged",
+			current:     map[string]string{"a": "1", managedAnnotationsAnnotation: "a"},
+			annotations: map[string]string{"a": "1", managedAnnotationsAnnotation: "a"},
+			want:        map[string]string{"a": "1", managedAnnotationsAnnotation: "a"},
+		},
+		{
+			name:        "changed and removed",
+			current:     map[string]string{"a": "1", "b": "2", managedAnnotationsAnnotation: "a,b"},
+			annotations: map[string]string{"a": "3"},
+			want:        map[string]string{"a": "3", managedAnnotationsAnnotation: "a"},
+		},
+		{
+			name:        "all removed",
+			current:     map[string]string{"a": "1", managedAnnotationsAnnotation: "a"},
+			annotations: nil,
+			want:        nil,
+		},
+		{
+			name:        "foreign annotations are kept",
+			current:     map[string]string{"a": "1", "cloud": "x", managedAnnotationsAnnotation: "a"},
+			annotations: nil,
+			want:        map[string]string{"cloud": "x"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := managedAnnotations(test.current, test.annotations); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: managedAnnotations() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUrlForMotis(t *testing.T) {
+	loadBalancer := &corev1.Service{
+		Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: []corev1.ServicePort{{Port: 8080}}},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.1"}}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		ingress *motisv1alpha1.IngressSpec
+		service *corev1.Service
+		want    string
+	}{
+		{"no ingress", nil, nil, ""},
+		{"ingress", &motisv1alpha1.IngressSpec{Host: "motis.example.com", Path: "/"}, nil, "http://motis.example.com/"},
+		{"ingress with path", &motisv1alpha1.IngressSpec{Host: "motis.example.com", Path: "/motis"}, nil, "http://motis.example.com/motis"},
+		{"tls", &motisv1alpha1.IngressSpec{Host: "motis.example.com", Path: "/", TLSSecretName: "tls"}, nil, "https://motis.example.com/"},
+		{"tls with path", &motisv1alpha1.IngressSpec{Host: "motis.example.com", Path: "/motis", TLSSecretName: "tls"}, loadBalancer, "https://motis.example.com/motis"},
+		{"load balancer", nil, loadBalancer, "http://192.0.2.1:8080"},
+	}
+
+	for _, test := range tests {
+		spec := &motisv1alpha1.MotisSpec{Ingress: test.ingress}
+		if got := urlForMotis(spec, test.service); got != test.want {
+			t.Errorf("%v: urlForMotis() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
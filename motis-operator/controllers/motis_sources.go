@@ -0,0 +1,371 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// The files in the config volume listing the schedule and OpenStreetMap URLs.
+const schedulesConfigFile = "schedules"
+const osmConfigFile = "osm"
+
+// The timeout of a single update check request.
+const sourceCheckTimeout = 30 * time.Second
+
+// The maximum duration of all update check requests of a Motis combined, and how
+// many of them run concurrently. The checks run within Reconcile, so they must not
+// block the reconcile worker for long.
+const sourceChecksTimeout = 2 * time.Minute
+const sourceCheckConcurrency = 8
+
+// sourceUrls returns the URLs of all schedules and OpenStreetMap files configured for motis.
+func (r *MotisReconciler) sourceUrls(ctx context.Context, motis *motisv1alpha1.Motis) ([]string, error) {
+	if motis.HasTypedConfig() {
+		var urls []string
+		for _, source := range append(append([]motisv1alpha1.Source{}, motis.Spec.Schedules...), motis.Spec.OSM...) {
+			urls = append(urls, source.URL)
+		}
+		return urls, nil
+	}
+
+	if motis.Spec.Config == nil {
+		return nil, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: motis.Spec.Config.Name, Namespace: motis.Namespace}, configMap); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, file := range []string{schedulesConfigFile, osmConfigFile} {
+		content := configMap.Data[motisv1alpha1.ConfigMapKeyForPath(motis.Spec.Config, file)]
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, strings.Fields(line)[0])
+		}
+	}
+
+	return urls, nil
+}
+
+// checkSources issues a conditional request for every source URL of motis and
+// reports whether any of them changed compared to the sources in the Motis status.
+// Sources which cannot be checked are considered changed. If latest failed, the
+// sources are considered changed as well, so a failed import is retried at the next
+// scheduled update instead of waiting for new upstream data.
+func (r *MotisReconciler) checkSources(ctx context.Context, motis *motisv1alpha1.Motis, latest *motisv1alpha1.Dataset, log logr.Logger) ([]motisv1alpha1.SourceStatus, bool) {
+	urls, err := r.sourceUrls(ctx, motis)
+	if err != nil {
+		log.Error(err, "Error reading source URLs. Assuming sources changed")
+		return nil, true
+	}
+
+	hosts, err := r.credentialsForMotis(ctx, motis)
+	if err != nil {
+		log.Error(err, "Error reading source credentials. Assuming sources changed")
+		return nil, true
+	}
+	client := &http.Client{
+		Timeout:   sourceCheckTimeout,
+		Transport: &credentialsTransport{base: http.DefaultTransport, hosts: hosts},
+	}
+
+	// The status only holds the redacted URLs, so the sources are matched by the hash of their URL.
+	previous := make(map[string]motisv1alpha1.SourceStatus)
+	for _, source := range motis.Status.Sources {
+		hash := source.URLHash
+		if hash == "" {
+			// Sources recorded by earlier operator versions hold the complete URL.
+			hash = urlHash(source.URL)
+		}
+		previous[hash] = source
+	}
+
+	changed := len(urls) != len(motis.Status.Sources)
+	if latest != nil && latest.HasFailed() {
+		log.Info("The latest Dataset failed. Retrying regardless of the sources", "Dataset.Name", latest.Name)
+		changed = true
+	}
+	var sources []motisv1alpha1.SourceStatus
+
+	// The sources are checked concurrently, the results are processed in order.
+	type check struct {
+		current   motisv1alpha1.SourceStatus
+		unchanged bool
+		err       error
+	}
+	checks := make([]check, len(urls))
+	checkCtx, cancel := context.WithTimeout(ctx, sourceChecksTimeout)
+	defer cancel()
+	slots := make(chan struct{}, sourceCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-checkCtx.Done():
+				checks[i].err = checkCtx.Err()
+				return
+			}
+			checks[i].current, checks[i].unchanged, checks[i].err = checkSource(checkCtx, client, url, previous[urlHash(url)])
+		}(i, url)
+	}
+	wg.Wait()
+
+	for i, url := range urls {
+		hash := urlHash(url)
+		_, known := previous[hash]
+		current := checks[i].current
+		if err := checks[i].err; err != nil {
+			log.Info("Error checking source for changes. Assuming it changed", "url", motisv1alpha1.RedactURL(url), "error", redactError(err).Error())
+			changed = true
+			current = motisv1alpha1.SourceStatus{}
+		} else if !known || !checks[i].unchanged {
+			log.Info("Source changed since the last update", "url", motisv1alpha1.RedactURL(url))
+			changed = true
+		}
+
+		current.URL = motisv1alpha1.RedactURL(url)
+		current.URLHash = hash
+		sources = append(sources, current)
+	}
+
+	return sources, changed
+}
+
+// redactError removes the URL from errors of the HTTP client, as it may contain credentials.
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%v %v: %w", urlErr.Op, motisv1alpha1.RedactURL(urlErr.URL), urlErr.Err)
+	}
+	return err
+}
+
+// urlHash returns the hex encoded SHA-256 hash of url.
+func urlHash(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkSource sends a conditional HEAD request for url. It returns the current
+// validators of the source and whether the source is unchanged compared to last.
+func checkSource(ctx context.Context, client *http.Client, url string, last motisv1alpha1.SourceStatus) (motisv1alpha1.SourceStatus, bool, error) {
+	resp, err := conditionalRequest(ctx, client, http.MethodHead, url, last)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		// Some servers do not support HEAD requests. Only the headers of the GET response are read.
+		resp, err = conditionalRequest(ctx, client, http.MethodGet, url, last)
+	}
+	if err != nil {
+		return last, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return last, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return last, false, fmt.Errorf("unexpected HTTP status %v", resp.Status)
+	}
+
+	current := motisv1alpha1.SourceStatus{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if resp.ContentLength >= 0 {
+		current.ContentLength = resp.ContentLength
+	}
+
+	var unchanged bool
+	switch {
+	case current.ETag != "" || last.ETag != "":
+		unchanged = current.ETag == last.ETag
+	case current.LastModified != "" || last.LastModified != "":
+		unchanged = current.LastModified == last.LastModified && current.ContentLength == last.ContentLength
+	default:
+		// Without validators there is no way to tell whether the source changed.
+		unchanged = false
+	}
+
+	return current, unchanged, nil
+}
+
+func conditionalRequest(ctx context.Context, client *http.Client, method string, url string, last motisv1alpha1.SourceStatus) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if last.ETag != "" {
+		req.Header.Set("If-None-Match", last.ETag)
+	}
+	if last.LastModified != "" {
+		req.Header.Set("If-Modified-Since", last.LastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// credentialsForMotis reads the credentials secret of motis. It returns the
+// credentials of every host as listed in the secret. Malformed credentials are
+// rejected, like the init container does.
+func (r *MotisReconciler) credentialsForMotis(ctx context.Context, motis *motisv1alpha1.Motis) (map[string]credentials, error) {
+	hosts := make(map[string]credentials)
+	if motis.Spec.Credentials == nil {
+		return hosts, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.APIReader.Get(ctx, types.NamespacedName{Name: motis.Spec.Credentials.SecretName, Namespace: motis.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	for key, value := range secret.Data {
+		host := key
+		if len(motis.Spec.Credentials.Items) > 0 {
+			host = ""
+			for _, item := range motis.Spec.Credentials.Items {
+				if item.Key == key {
+					host = item.Path
+				}
+			}
+		}
+		if host == "" {
+			continue
+		}
+
+		c, err := parseCredentials(string(value))
+		if err != nil {
+			// The error must not include the content of the secret.
+			return nil, fmt.Errorf("invalid credentials for host %v: %w", host, err)
+		}
+		hosts[strings.ToLower(host)] = c
+	}
+
+	return hosts, nil
+}
+
+// credentials are added to every request to a host. The format of the secret and
+// the errors for malformed lines match parseCredentials in the init container, so
+// both agree about every secret. Each host has the following lines:
+//
+//	bearer=<token>
+//	basic=<username>:<password>
+//	header=<name>: <value>
+type credentials struct {
+	bearer   string
+	username string
+	password string
+	headers  http.Header
+}
+
+func parseCredentials(content string) (credentials, error) {
+	c := credentials{headers: http.Header{}}
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, value, found := strings.Cut(line, "=")
+		if !found {
+			return c, fmt.Errorf("line %d: expected bearer=, basic= or header=", i+1)
+		}
+
+		switch kind {
+		case "bearer":
+			c.bearer = value
+		case "basic":
+			username, password, found := strings.Cut(value, ":")
+			if !found {
+				return c, fmt.Errorf("line %d: expected basic=<username>:<password>", i+1)
+			}
+			c.username, c.password = username, password
+		case "header":
+			name, headerValue, found := strings.Cut(value, ":")
+			if !found {
+				return c, fmt.Errorf("line %d: expected header=<name>: <value>", i+1)
+			}
+			c.headers.Add(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+		default:
+			return c, fmt.Errorf("line %d: unknown credential type %q", i+1, kind)
+		}
+	}
+
+	return c, nil
+}
+
+func (c credentials) apply(req *http.Request) {
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for name, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
+
+// credentialsTransport adds the credentials of the requested host to every request,
+// in the same way the init container does. Redirects to other hosts therefore never
+// receive credentials meant for the original host.
+type credentialsTransport struct {
+	base  http.RoundTripper
+	hosts map[string]credentials
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, ok := t.hosts[strings.ToLower(req.URL.Hostname())]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	c.apply(req)
+	return t.base.RoundTrip(req)
+}
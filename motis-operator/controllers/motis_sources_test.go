@@ -0,0 +1,176 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestCheckSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	url := server.URL + "/gtfs.zip?token=secret"
+	datasetWithCondition := func(condition string) *motisv1alpha1.Dataset {
+		return &motisv1alpha1.Dataset{
+			ObjectMeta: metav1.ObjectMeta{Name: "motis-abcde"},
+			Status: motisv1alpha1.DatasetStatus{
+				Conditions: []metav1.Condition{{Type: condition, Status: metav1.ConditionTrue}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		sources []motisv1alpha1.SourceStatus
+		latest  *motisv1alpha1.Dataset
+		want    bool
+	}{
+		{"first check", nil, nil, true},
+		{"unchanged", []motisv1alpha1.SourceStatus{{URLHash: urlHash(url), ETag: `"v1"`}}, datasetWithCondition(motisv1alpha1.DatasetReady), false},
+		{"unchanged with complete URL of earlier versions", []motisv1alpha1.SourceStatus{{URL: url, ETag: `"v1"`}}, datasetWithCondition(motisv1alpha1.DatasetReady), false},
+		{"changed", []motisv1alpha1.SourceStatus{{URLHash: urlHash(url), ETag: `"v0"`}}, datasetWithCondition(motisv1alpha1.DatasetReady), true},
+		{"other source", []motisv1alpha1.SourceStatus{{URLHash: urlHash(server.URL + "/gtfs.zip"), ETag: `"v1"`}}, datasetWithCondition(motisv1alpha1.DatasetReady), true},
+		{"unchanged after failed import", []motisv1alpha1.SourceStatus{{URLHash: urlHash(url), ETag: `"v1"`}}, datasetWithCondition(motisv1alpha1.DatasetFailed), true},
+	}
+
+	r := &MotisReconciler{}
+	for _, test := range tests {
+		motis := &motisv1alpha1.Motis{
+			Spec:   motisv1alpha1.MotisSpec{Schedules: []motisv1alpha1.Source{{URL: url}}},
+			Status: motisv1alpha1.MotisStatus{Sources: test.sources},
+		}
+
+		sources, changed := r.checkSources(context.Background(), motis, test.latest, logr.Discard())
+		if changed != test.want {
+			t.Errorf("%v: checkSources() changed = %v, want %v", test.name, changed, test.want)
+		}
+		if len(sources) != 1 || sources[0].ETag != `"v1"` {
+			t.Errorf("%v: checkSources() sources = %v, want the current ETag", test.name, sources)
+			continue
+		}
+		if sources[0].URL != server.URL+"/gtfs.zip" || sources[0].URLHash != urlHash(url) {
+			t.Errorf("%v: checkSources() recorded URL %q with hash %q, want the redacted URL and the hash of the complete URL", test.name, sources[0].URL, sources[0].URLHash)
+		}
+	}
+}
+
+func TestCheckSourcesLimitsConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("ETag", `"v1"`)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var schedules []motisv1alpha1.Source
+	for i := 0; i < 3*sourceCheckConcurrency; i++ {
+		schedules = append(schedules, motisv1alpha1.Source{URL: fmt.Sprintf("%v/gtfs-%d.zip", server.URL, i)})
+	}
+	motis := &motisv1alpha1.Motis{Spec: motisv1alpha1.MotisSpec{Schedules: schedules}}
+
+	sources, _ := (&MotisReconciler{}).checkSources(context.Background(), motis, nil, logr.Discard())
+
+	if maxActive > sourceCheckConcurrency || maxActive < 2 {
+		t.Errorf("checkSources() sent %d concurrent requests, want between 2 and %d", maxActive, sourceCheckConcurrency)
+	}
+	if len(sources) != len(schedules) {
+		t.Fatalf("checkSources() returned %d sources, want %d", len(sources), len(schedules))
+	}
+	for i, source := range sources {
+		if source.URL != schedules[i].URL || source.ETag != `"v1"` {
+			t.Errorf("checkSources() source %d = %v, want %v in order", i, source, schedules[i].URL)
+		}
+	}
+}
+
+// The cases match the tests of parseCredentials in the init container, as both must agree about every secret
+// and authenticate the requests to a host in the same way.
+func TestParseCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantHeaders http.Header
+		wantErr     bool
+	}{
+		{"no credentials", "# comment\n\n", http.Header{}, false},
+		{"bearer token", "bearer=secret\n", http.Header{"Authorization": {"Bearer secret"}}, false},
+		{"bearer token with padding", "bearer=c2VjcmV0==", http.Header{"Authorization": {"Bearer c2VjcmV0=="}}, false},
+		{"basic auth", "basic=user:secret", http.Header{"Authorization": {"Basic dXNlcjpzZWNyZXQ="}}, false},
+		{"colon in password", "basic=user:se:cret", http.Header{"Authorization": {"Basic dXNlcjpzZTpjcmV0"}}, false},
+		{"basic auth after bearer token", "bearer=secret\nbasic=user:secret\n", http.Header{"Authorization": {"Basic dXNlcjpzZWNyZXQ="}}, false},
+		{"headers", "# comment\r\n  header=x-api-key: secret \r\nheader=X-Api-Key:other\r\n", http.Header{"X-Api-Key": {"secret", "other"}}, false},
+		{"missing separator", "secret\n", nil, true},
+		{"basic auth without password", "basic=user\n", nil, true},
+		{"header without value", "header=X-Api-Key\n", nil, true},
+		{"unknown type", "token=secret\n", nil, true},
+		{"type with other case", "Bearer=secret\n", nil, true},
+	}
+
+	for _, test := range tests {
+		c, err := parseCredentials(test.content)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: parseCredentials() error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("%v: parseCredentials() error %q contains the credentials", test.name, err)
+			}
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/gtfs.zip", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.apply(req)
+		if !reflect.DeepEqual(req.Header, test.wantHeaders) {
+			t.Errorf("%v: apply() set headers %v, want %v", test.name, req.Header, test.wantHeaders)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// updateStatus records the latest and the served Dataset of motis, together with
+// the resulting conditions. next is the Dataset being switched to, which equals current
+// once its Deployment is available. current, next and deployment are nil as long as no
+// Dataset has finished processing.
+func (r *MotisReconciler) updateStatus(ctx context.Context, motis *motisv1alpha1.Motis, latest *motisv1alpha1.Dataset, current *motisv1alpha1.Dataset, next *motisv1alpha1.Dataset, deployment *appsv1.Deployment, nextUpdate *time.Time) error {
+	if latest != nil {
+		motis.Status.LatestDataset = latest.Name
+	}
+	if current != nil && current.Name != motis.Status.CurrentDataset {
+		now := metav1.Now()
+		motis.Status.CurrentDataset = current.Name
+		motis.Status.LastUpdateTime = &now
+	}
+
+	motis.Status.NextUpdateTime = nil
+	if nextUpdate != nil {
+		next := metav1.NewTime(*nextUpdate)
+		motis.Status.NextUpdateTime = &next
+	}
+
+	service := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Name: motis.Name, Namespace: motis.Namespace}, service); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		service = nil
+	}
+	motis.Status.Endpoint = endpointForService(service)
+	motis.Status.URL = urlForMotis(r.specForMotis(motis), service)
+
+	var pods []corev1.Pod
+	if deployment != nil && deployment.UID != "" && deployment.Status.AvailableReplicas == 0 {
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList, client.InNamespace(motis.Namespace), client.MatchingLabels(deployment.Spec.Selector.MatchLabels)); err != nil {
+			return err
+		}
+		pods = podList.Items
+	}
+
+	setMotisConditions(motis, latest, current, next, deployment, pods)
+
+	return r.Status().Update(ctx, motis)
+}
+
+// endpointForService returns the in-cluster URL of service, or an empty string if there is no service.
+func endpointForService(service *corev1.Service) string {
+	if service == nil || len(service.Spec.Ports) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("http://%v.%v.svc:%d", service.Name, service.Namespace, service.Spec.Ports[0].Port)
+}
+
+// setMotisConditions sets the Ready, Updating and Degraded conditions of motis. pods are the
+// pods of deployment, which explain why it has no available replica.
+func setMotisConditions(motis *motisv1alpha1.Motis, latest *motisv1alpha1.Dataset, current *motisv1alpha1.Dataset, next *motisv1alpha1.Dataset, deployment *appsv1.Deployment, pods []corev1.Pod) {
+	available := deployment != nil && deployment.UID != "" && deployment.Status.AvailableReplicas > 0
+	latestFailure := datasetFailure(latest)
+
+	ready := metav1.Condition{Type: motisv1alpha1.MotisReady, ObservedGeneration: motis.Generation}
+	switch {
+	case current == nil:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "NoDataset", "No Dataset has finished processing yet"
+	case available:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionTrue, "Available", fmt.Sprintf("Serving Dataset %v", current.Name)
+	default:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "DeploymentUnavailable", "The MOTIS deployment has no available replica"
+		if reason, message := serverPodProblem(pods); reason != "" {
+			ready.Reason, ready.Message = reason, message
+		}
+	}
+	meta.SetStatusCondition(&motis.Status.Conditions, ready)
+
+	updating := metav1.Condition{Type: motisv1alpha1.MotisUpdating, ObservedGeneration: motis.Generation}
+	switch {
+	case current != nil && next != nil && next.Name != current.Name:
+		updating.Status, updating.Reason = metav1.ConditionTrue, "SwitchingDataset"
+		updating.Message = fmt.Sprintf("Switching from Dataset %v to Dataset %v once its deployment is available", current.Name, next.Name)
+	case motis.Status.Pinned:
+		updating.Status, updating.Reason = metav1.ConditionFalse, "Pinned"
+		updating.Message = fmt.Sprintf("Dataset %v is pinned, newer Datasets are not served", motis.Spec.PinnedDataset)
+	case latestFailure != nil:
+		updating.Status, updating.Reason, updating.Message = metav1.ConditionFalse, "DatasetFailed", fmt.Sprintf("Dataset %v failed", latest.Name)
+	case latest != nil && (current == nil || latest.Name != current.Name):
+		updating.Status, updating.Reason, updating.Message = metav1.ConditionTrue, "DatasetProcessing", fmt.Sprintf("Dataset %v is processing", latest.Name)
+	default:
+		updating.Status, updating.Reason = metav1.ConditionFalse, "UpToDate"
+	}
+	meta.SetStatusCondition(&motis.Status.Conditions, updating)
+
+	degraded := metav1.Condition{Type: motisv1alpha1.MotisDegraded, ObservedGeneration: motis.Generation}
+	switch {
+	case latestFailure != nil:
+		degraded.Status, degraded.Reason = metav1.ConditionTrue, "DatasetFailed"
+		degraded.Message = fmt.Sprintf("Dataset %v failed: %v", latest.Name, latestFailure.Message)
+	case current != nil && !available && deployment != nil && deployment.UID != "":
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, "DeploymentUnavailable", "The MOTIS deployment has no available replica"
+	default:
+		degraded.Status, degraded.Reason = metav1.ConditionFalse, "AsExpected"
+	}
+	meta.SetStatusCondition(&motis.Status.Conditions, degraded)
+}
+
+// datasetFailure returns the Failed condition of dataset, if the dataset failed.
+func datasetFailure(dataset *motisv1alpha1.Dataset) *metav1.Condition {
+	if dataset == nil || !dataset.HasFailed() {
+		return nil
+	}
+	return meta.FindStatusCondition(dataset.Status.Conditions, motisv1alpha1.DatasetFailed)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func TestSetMotisConditions(t *testing.T) {
+	now := time.Now()
+	served := testDataset("motis-served", now.Add(-2*time.Hour), motisv1alpha1.DatasetReady)
+	newer := testDataset("motis-newer", now.Add(-time.Hour), motisv1alpha1.DatasetReady)
+	processing := testDataset("motis-processing", now, "")
+	failed := testDataset("motis-failed", now, motisv1alpha1.DatasetFailed)
+	failed.Status.Conditions[0].Message = "The import failed"
+
+	available := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{UID: "deployment-uid"},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}
+	unavailable := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{UID: "deployment-uid"}}
+	// A Deployment which is not created yet has no UID.
+	notCreated := &appsv1.Deployment{}
+	started := false
+	startingPods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "motis-served-abcde"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:    "motis",
+			State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			Started: &started,
+		}}},
+	}}
+
+	type condition struct {
+		status metav1.ConditionStatus
+		reason string
+	}
+	tests := []struct {
+		name                      string
+		pinned                    bool
+		latest, current, next     *motisv1alpha1.Dataset
+		deployment                *appsv1.Deployment
+		pods                      []corev1.Pod
+		ready, updating, degraded condition
+	}{
+		{
+			"first Dataset processing", false, processing, nil, nil, nil, nil,
+			condition{metav1.ConditionFalse, "NoDataset"}, condition{metav1.ConditionTrue, "DatasetProcessing"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			"serving the latest Dataset", false, served, served, served, available, nil,
+			condition{metav1.ConditionTrue, "Available"}, condition{metav1.ConditionFalse, "UpToDate"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			"switching to a newer Dataset", false, newer, served, newer, available, nil,
+			condition{metav1.ConditionTrue, "Available"}, condition{metav1.ConditionTrue, "SwitchingDataset"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			"newer Dataset processing", false, processing, served, served, available, nil,
+			condition{metav1.ConditionTrue, "Available"}, condition{metav1.ConditionTrue, "DatasetProcessing"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			"newer Dataset failed", false, failed, served, served, available, nil,
+			condition{metav1.ConditionTrue, "Available"}, condition{metav1.ConditionFalse, "DatasetFailed"}, condition{metav1.ConditionTrue, "DatasetFailed"},
+		},
+		{
+			"pinned Dataset", true, newer, served, served, available, nil,
+			condition{metav1.ConditionTrue, "Available"}, condition{metav1.ConditionFalse, "Pinned"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			"server starting", false, served, served, served, unavailable, startingPods,
+			condition{metav1.ConditionFalse, "ServerStarting"}, condition{metav1.ConditionFalse, "UpToDate"}, condition{metav1.ConditionTrue, "DeploymentUnavailable"},
+		},
+		{
+			"deployment not created yet", false, served, served, served, notCreated, nil,
+			condition{metav1.ConditionFalse, "DeploymentUnavailable"}, condition{metav1.ConditionFalse, "UpToDate"}, condition{metav1.ConditionFalse, "AsExpected"},
+		},
+	}
+
+	for _, test := range tests {
+		motis := testMotis()
+		motis.Status.Pinned = test.pinned
+		if test.pinned {
+			motis.Spec.PinnedDataset = test.current.Name
+		}
+
+		setMotisConditions(motis, test.latest, test.current, test.next, test.deployment, test.pods)
+
+		for conditionType, want := range map[string]condition{
+			motisv1alpha1.MotisReady:    test.ready,
+			motisv1alpha1.MotisUpdating: test.updating,
+			motisv1alpha1.MotisDegraded: test.degraded,
+		} {
+			got := meta.FindStatusCondition(motis.Status.Conditions, conditionType)
+			if got == nil || got.Status != want.status || got.Reason != want.reason {
+				t.Errorf("%v: setMotisConditions() %v = %v, want status %v with reason %v", test.name, conditionType, got, want.status, want.reason)
+			}
+		}
+	}
+}
+
+func TestSetMotisConditionsTransitions(t *testing.T) {
+	now := time.Now()
+	served := testDataset("motis-served", now.Add(-2*time.Hour), motisv1alpha1.DatasetReady)
+	newer := testDataset("motis-newer", now.Add(-time.Hour), motisv1alpha1.DatasetReady)
+	available := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{UID: "deployment-uid"},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}
+
+	motis := testMotis()
+	setMotisConditions(motis, served, served, served, available, nil)
+	lastTransition := metav1.NewTime(now.Add(-time.Hour))
+	for i := range motis.Status.Conditions {
+		motis.Status.Conditions[i].LastTransitionTime = lastTransition
+	}
+
+	setMotisConditions(motis, newer, served, newer, available, nil)
+
+	for _, condition := range motis.Status.Conditions {
+		changed := condition.Type == motisv1alpha1.MotisUpdating
+		if transitioned := !condition.LastTransitionTime.Equal(&lastTransition); transitioned != changed {
+			t.Errorf("setMotisConditions() changed the transition time of %v: %v, want %v", condition.Type, transitioned, changed)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+// applyPodOverrides merges overrides into template with a strategic merge patch, so
+// lists like the containers are merged by name instead of being replaced.
+func applyPodOverrides(template *corev1.PodTemplateSpec, overrides *motisv1alpha1.PodOverrides) error {
+	if overrides == nil {
+		return nil
+	}
+
+	original, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(podOverridesPatch(template, overrides))
+	if err != nil {
+		return err
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodTemplateSpec{})
+	if err != nil {
+		return err
+	}
+
+	result := corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return err
+	}
+	*template = result
+	return nil
+}
+
+// podOverridesPatch returns the strategic merge patch for overrides. It is built as a map,
+// as unset fields of the typed pod spec would marshal to null and remove the containers.
+func podOverridesPatch(template *corev1.PodTemplateSpec, overrides *motisv1alpha1.PodOverrides) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if overrides.Labels != nil {
+		labels := map[string]string{}
+		for key, value := range overrides.Labels {
+			// The labels set by the operator select the pods and must not change.
+			if _, ok := template.Labels[key]; !ok {
+				labels[key] = value
+			}
+		}
+		metadata["labels"] = labels
+	}
+	if overrides.Annotations != nil {
+		metadata["annotations"] = overrides.Annotations
+	}
+
+	spec := map[string]interface{}{}
+	if overrides.NodeSelector != nil {
+		spec["nodeSelector"] = overrides.NodeSelector
+	}
+	if overrides.Tolerations != nil {
+		spec["tolerations"] = overrides.Tolerations
+	}
+	if overrides.Affinity != nil {
+		spec["affinity"] = overrides.Affinity
+	}
+	if overrides.SecurityContext != nil {
+		spec["securityContext"] = overrides.SecurityContext
+	}
+	if overrides.PriorityClassName != "" {
+		spec["priorityClassName"] = overrides.PriorityClassName
+	}
+	if overrides.ContainerSecurityContext != nil {
+		if len(template.Spec.InitContainers) > 0 {
+			spec["initContainers"] = containerSecurityContextPatch(template.Spec.InitContainers, overrides.ContainerSecurityContext)
+		}
+		spec["containers"] = containerSecurityContextPatch(template.Spec.Containers, overrides.ContainerSecurityContext)
+	}
+
+	return map[string]interface{}{
+		"metadata": metadata,
+		"spec":     spec,
+	}
+}
+
+// containerSecurityContextPatch returns the patch setting the security context of each of containers.
+func containerSecurityContextPatch(containers []corev1.Container, securityContext *corev1.SecurityContext) []map[string]interface{} {
+	patch := []map[string]interface{}{}
+	for _, container := range containers {
+		patch = append(patch, map[string]interface{}{
+			"name":            container.Name,
+			"securityContext": securityContext,
+		})
+	}
+	return patch
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	motisv1alpha1 "github.com/vstollen/motis-operator/api/v1alpha1"
+)
+
+func testPodTemplate() *corev1.PodTemplateSpec {
+	return &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{datasetLabel: "motis-abcde"}},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "motis-init", Image: "motis-init"}},
+			Containers: []corev1.Container{{
+				Name:            "motis",
+				Image:           "motis",
+				SecurityContext: &corev1.SecurityContext{Privileged: new(bool)},
+			}},
+		},
+	}
+}
+
+func TestApplyPodOverrides(t *testing.T) {
+	runAsNonRoot := true
+	tolerations := []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "motis", Effect: corev1.TaintEffectNoSchedule}}
+	securityContext := &corev1.SecurityContext{RunAsNonRoot: &runAsNonRoot}
+
+	overrides := &motisv1alpha1.PodOverrides{
+		Labels:                   map[string]string{datasetLabel: "other", "team": "transit"},
+		Annotations:              map[string]string{"example.com/owner": "transit"},
+		NodeSelector:             map[string]string{"pool": "motis"},
+		Tolerations:              tolerations,
+		ContainerSecurityContext: securityContext,
+	}
+
+	template := testPodTemplate()
+	if err := applyPodOverrides(template, overrides); err != nil {
+		t.Fatalf("applyPodOverrides() error = %v", err)
+	}
+
+	wantLabels := map[string]string{datasetLabel: "motis-abcde", "team": "transit"}
+	if !reflect.DeepEqual(template.Labels, wantLabels) {
+		t.Errorf("applyPodOverrides() labels = %v, want %v", template.Labels, wantLabels)
+	}
+	if !reflect.DeepEqual(template.Annotations, overrides.Annotations) {
+		t.Errorf("applyPodOverrides() annotations = %v, want %v", template.Annotations, overrides.Annotations)
+	}
+	if !reflect.DeepEqual(template.Spec.NodeSelector, overrides.NodeSelector) {
+		t.Errorf("applyPodOverrides() node selector = %v, want %v", template.Spec.NodeSelector, overrides.NodeSelector)
+	}
+	if !reflect.DeepEqual(template.Spec.Tolerations, tolerations) {
+		t.Errorf("applyPodOverrides() tolerations = %v, want %v", template.Spec.Tolerations, tolerations)
+	}
+
+	containers := append(template.Spec.InitContainers, template.Spec.Containers...)
+	if len(containers) != 2 || containers[0].Image != "motis-init" || containers[1].Image != "motis" {
+		t.Fatalf("applyPodOverrides() containers = %v, want the containers of the template", containers)
+	}
+	for _, container := range containers {
+		if container.SecurityContext == nil || container.SecurityContext.RunAsNonRoot == nil || !*container.SecurityContext.RunAsNonRoot {
+			t.Errorf("applyPodOverrides() security context of %v = %v, want runAsNonRoot", container.Name, container.SecurityContext)
+		}
+	}
+	// The security context is merged into the one set by the operator.
+	if privileged := containers[1].SecurityContext.Privileged; privileged == nil || *privileged {
+		t.Errorf("applyPodOverrides() privileged = %v, want the value of the template", privileged)
+	}
+}
+
+func TestApplyPodOverridesWithoutOverrides(t *testing.T) {
+	for _, overrides := range []*motisv1alpha1.PodOverrides{nil, {}} {
+		template := testPodTemplate()
+		if err := applyPodOverrides(template, overrides); err != nil {
+			t.Fatalf("applyPodOverrides(%v) error = %v", overrides, err)
+		}
+		if want := testPodTemplate(); !reflect.DeepEqual(template, want) {
+			t.Errorf("applyPodOverrides(%v) = %v, want the unchanged template %v", overrides, template, want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 // Next.js API route support: https://nextjs.org/docs/api-routes/introduction
 import type { NextApiRequest, NextApiResponse } from "next";
-import {coreV1Api, customObjectsApi} from "../../services/kubernetes/kubernetes";
-import {V1ConfigMap} from "@kubernetes/client-node";
+import {customObjectsApi} from "../../services/kubernetes/kubernetes";
 import {ListMotisInstance} from "../../types/api";
 
 interface BaseResponse {
@@ -47,17 +46,33 @@ async function handleGetRequest(req: NextApiRequest, res: NextApiResponse<GetRes
   const motisObjectsResponse = (await motisObjects).body.items.map((item) => {
     return {
       name: item.metadata.name,
-      status: "unknown"
+      status: motisStatus(item.status)
     }
   })
   console.log(await motisObjects);
   res.status(200).json({message: "success", instances: motisObjectsResponse});
 }
 
+// motisStatus summarizes the conditions the operator maintains on a Motis instance.
+function motisStatus(status?: { conditions?: { type: string, status: string, reason: string }[] }): string {
+  const conditions = status?.conditions ?? [];
+  const condition = (type: string) => conditions.find((c) => c.type === type);
+
+  if (condition("Degraded")?.status === "True") {
+    return `degraded (${condition("Degraded")?.reason})`;
+  }
+  if (condition("Updating")?.status === "True") {
+    return "updating";
+  }
+  if (condition("Ready")?.status === "True") {
+    return "ready";
+  }
+  return condition("Ready")?.reason ?? "unknown";
+}
+
 async function handlePostRequest(req: NextApiRequest, res: NextApiResponse<BaseResponse>) {
   const requestBody: createMotisRequestBody = req.body;
-  const configMap = generateConfigMap(requestBody.name, requestBody.config, requestBody.scheduleUrl, requestBody.osmUrl);
-  await coreV1Api.createNamespacedConfigMap("default", configMap);
+  // The operator renders the config map of the instance from the sources and the raw config.
   await customObjectsApi.createNamespacedCustomObject("motis.motis-project.de", "v1alpha1", "default", "motis", {
     apiVersion: "motis.motis-project.de/v1alpha1",
     kind: "Motis",
@@ -65,39 +80,18 @@ async function handlePostRequest(req: NextApiRequest, res: NextApiResponse<BaseR
       name: requestBody.name
     },
     spec: {
-      config: {
-        name: requestBody.name,
-        items: [
-          {
-            key: "config-file",
-            path: "config.ini"
-          },
-          {
-            key: "schedules",
-            path: "schedules"
-          },
-          {
-            key: "osm",
-            path: "osm"
-          },
-        ]
-      },
+      schedules: parseSources(requestBody.scheduleUrl),
+      osm: parseSources(requestBody.osmUrl),
+      rawConfig: requestBody.config,
     }
   });
   res.status(202).json({ message: "success" });
 }
 
-function generateConfigMap(name: string, configIni: string, scheduleUrl: string, osmUrl: string): V1ConfigMap {
-  return {
-    apiVersion: "v1",
-    kind: "ConfigMap",
-    metadata: {
-      name: name
-    },
-    data: {
-      "config-file": configIni,
-      schedules: scheduleUrl,
-      osm: osmUrl
-    }
-  }
-}
\ No newline at end of file
+function parseSources(urls: string): { url: string }[] {
+  return urls
+      .split("\n")
+      .map((url) => url.trim())
+      .filter((url) => url !== "")
+      .map((url) => ({url: url}));
+}